@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+
+	"ollama-proxy/internal/proxy"
+)
+
+// fileConfig is the content of the -config file. Everything but the listen address is
+// applied again when the proxy receives SIGHUP.
+type fileConfig struct {
+	Listen         string            `json:"listen,omitempty"`
+	Routes         map[string]string `json:"routes,omitempty"`
+	InterceptPaths []string          `json:"intercept_paths,omitempty"`
+}
+
+// loadConfig reads the config file, an empty path yields an empty config
+func loadConfig(path string) (fileConfig, error) {
+	var cfg fileConfig
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// mergeRoutes combines the routes of the config file with the -route flags, which take precedence
+func mergeRoutes(cfg fileConfig, flags routeFlag) map[string]string {
+	routes := make(map[string]string, len(cfg.Routes)+len(flags))
+	maps.Copy(routes, cfg.Routes)
+	maps.Copy(routes, flags)
+	return routes
+}
+
+// reloadConfig re-reads the config file and applies the settings that can change at runtime.
+// The listener and the tracker are left untouched, so active calls keep running.
+func reloadConfig(path, listenAddr string, flags routeFlag, p *proxy.Proxy) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		log.Printf("ERROR: Failed to reload config: %v", err)
+		return
+	}
+	if err := p.SetRoutes(mergeRoutes(cfg, flags)); err != nil {
+		log.Printf("ERROR: Failed to reload config: %v", err)
+		return
+	}
+	p.SetInterceptPaths(cfg.InterceptPaths)
+	if cfg.Listen != "" && cfg.Listen != listenAddr {
+		log.Printf("WARN: Listening on %s instead of %s requires a restart", cfg.Listen, listenAddr)
+	}
+	log.Printf("Reloaded config from %s", path)
+}
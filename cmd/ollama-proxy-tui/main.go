@@ -3,25 +3,123 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"ollama-proxy/internal/accesslog"
+	"ollama-proxy/internal/api"
+	"ollama-proxy/internal/callprinter"
 	"ollama-proxy/internal/proxy"
+	"ollama-proxy/internal/proxy/interceptor"
+	"ollama-proxy/internal/tracing"
 	"ollama-proxy/internal/tracker"
 	"ollama-proxy/internal/tui"
+	"ollama-proxy/internal/web"
 )
 
 func main() {
 	// Parse command line flags
-	listenAddr := flag.String("listen", ":11444", "Address to listen on")
+	listenAddr := flag.String("listen", ":11444", "Address to listen on, or unix:/path/to.sock for a Unix socket; comma-separated for several")
+	name := flag.String("name", "", "Name of this instance, shown in the TUI and terminal title and added to the logs")
 	targetURL := flag.String("target", "http://localhost:11434", "Ollama API URL")
-	maxCalls := flag.Int("max-calls", 50, "Maximum number of calls to keep in history")
+	targetPathPrefix := flag.String("target-path-prefix", "", "Path under which Ollama is served on the target, e.g. /ollama")
+	upstreamHost := flag.String("upstream-host", "", "Host header to send to the target instead of the client's, for name-based routing")
+	requireUpstream := flag.Bool("require-upstream", false, "Refuse to start if the target does not answer /api/version")
+	healthInterval := flag.Duration("health-interval", 10*time.Second, "Probe the target this often and show whether it is up (0 checks only on startup)")
+	maxCalls := flag.Int("max-calls", 50, "Maximum number of calls to keep in history (0 for no limit)")
+	var maxMemory byteSizeFlag
+	flag.Var(&maxMemory, "max-memory", "Remove the oldest finished calls once the kept bodies exceed this size, e.g. 512MB")
+	compressHistory := flag.Bool("compress-history", false, "Gzip the request and response of finished calls to keep more history in the same memory")
+	maxAge := flag.Duration("max-age", 0, "Remove finished calls from the history this long after they ended (0 keeps them)")
+	callIDs := flag.String("call-ids", "uuid", "How calls are named: "+strings.Join(tracker.IDSchemes, ", ")+" (1, 2, 3, ...)")
+	listWidth := flag.Int("list-width", 40, "Initial width of the call list in columns")
+	themeName := flag.String("theme", tui.DefaultTheme, "Color theme: "+strings.Join(tui.ThemeNames(), ", "))
+	saveUIState := flag.Bool("save-ui-state", false, "Restore the TUI state on startup and save it on exit")
+	logLines := flag.Int("log-lines", 1000, "Number of lines kept in the TUI log pane")
+	logBuffer := flag.Int("log-buffer", 1000, "Number of log lines queued for the TUI log pane before logging waits")
+	eventBuffer := flag.Int("event-buffer", tracker.DefaultEventBuffer, "Number of call events queued for the TUI and each other consumer before progress updates are dropped")
+	timeFormat := flag.String("time-format", "", "Go time layout of call start times in the TUI, e.g. 15:04:05.000 (default: 15:04:05 in the list, date and time in the details)")
+	utc := flag.Bool("utc", false, "Show times in the TUI in UTC instead of the local time zone")
+	mouse := flag.Bool("mouse", false, "Enable mouse support in the TUI")
+	curlBase := flag.String("curl-base", "", "Base URL for calls copied as curl commands (default: the upstream each call was sent to)")
+	follow := flag.Bool("follow", false, "Start with the newest active call selected (toggle with f)")
+	captureHeaders := flag.Bool("capture-headers", false, "Capture request and response headers of each call (sensitive values are redacted)")
+	streamIdleTimeout := flag.Duration("stream-idle-timeout", 0, "Abort calls whose upstream sends nothing for this long (0 disables)")
+	var verbose bool
+	flag.BoolVar(&verbose, "verbose", false, "Log the request and response bodies of every call")
+	flag.BoolVar(&verbose, "v", false, "Shorthand for -verbose")
+	maxBody := flag.Int("max-body", 4096, "Maximum number of bytes of each body written to the log (0 for no limit)")
+	maxIdleConns := flag.Int("max-idle-conns", 16, "Idle connections kept open to each upstream (0 for Go's default of 2)")
+	maxConnsPerHost := flag.Int("max-conns-per-host", 0, "Maximum connections to each upstream, further requests wait (0 for no limit)")
+	idleConnTimeout := flag.Duration("idle-conn-timeout", 90*time.Second, "Close idle upstream connections after this long (0 keeps them open)")
+	proxyHeader := flag.Bool("proxy-header", false, "Add an X-Ollama-Proxy: 1 header to every response")
+	useHTTP2 := flag.Bool("http2", false, "Use HTTP/2 with TLS upstreams and accept unencrypted HTTP/2 (h2c) clients")
+	traceChunks := flag.Bool("trace-chunks", false, "Log every response chunk of intercepted calls with its size and the time since the previous one")
+	forwardedHeaders := flag.Bool("forwarded-headers", true, "Send X-Forwarded-For/-Host/-Proto headers upstream")
+	accessLogPath := flag.String("access-log", "", "Append a JSON line for every finished call to this file (reopened on SIGHUP)")
+	otelEndpoint := flag.String("otel-endpoint", "", "OTLP/HTTP collector to export a trace span per call to, e.g. http://localhost:4318")
+	retry429 := flag.Int("retry-429", 0, "Retry requests the upstream answers with 429 up to this many times, honoring Retry-After")
+	retry429MaxWait := flag.Duration("retry-429-max-wait", 30*time.Second, "Longest wait before a retry with -retry-429")
+	singleFlight := flag.Bool("single-flight", false, "Share the response of identical concurrent requests instead of forwarding each")
+	collapseStream := flag.Bool("collapse-stream", false, "Send streamed responses as one JSON object to clients asking for it with "+interceptor.CollapseHeader+": 1 or ?"+interceptor.CollapseParam+"=1")
+	synthStream := flag.Bool("synth-stream", false, "Send complete responses to chat and generate requests that asked for a stream in word-sized pieces, for backends that do not stream")
+	synthStreamDelay := flag.Duration("synth-stream-delay", 20*time.Millisecond, "Pause between the pieces sent with -synth-stream")
+	validateRequests := flag.Bool("validate-requests", false, "Warn about unknown or missing fields in chat and generate requests")
+	noBodies := flag.Bool("no-bodies", false, "Track calls without keeping request and response bodies")
+	noRequestBuffer := flag.Bool("no-request-buffer", false, "Stream request bodies over -request-buffer-limit upstream without capturing them")
+	requestBufferLimit := byteSizeFlag(8 << 20)
+	flag.Var(&requestBufferLimit, "request-buffer-limit", "Size up to which request bodies are buffered and captured with -no-request-buffer, e.g. 8MB")
+	passthrough := flag.Bool("passthrough", false, "Forward every request untouched, without interception or tracking")
+	apiListen := flag.String("api-listen", "", "Address for a separate management listener serving /healthz, /metrics and /calls")
+	webListen := flag.String("web-listen", "", "Address to serve a browser dashboard and the management API on")
+	apiOnMain := flag.Bool("listen-metrics-on-main", false, "Serve the management endpoints on the proxy listener under /__proxy/")
+	configPath := flag.String("config", "", "JSON config file with routes and intercept paths (reloaded on SIGHUP)")
+	routes := routeFlag{}
+	rates := rateFlag{}
+	var redact redactFlag
+	flag.Var(&redact, "redact", "Replace matches of this regular expression in the stored bodies with [REDACTED], in each streamed response object on its own (repeatable)")
+	flag.Var(rates, "rate", "Limit requests per endpoint, e.g. chat=10/s,generate=2/s (repeatable)")
+	flag.Var(routes, "route", "Route a model to a different upstream as model=url (repeatable)")
+	noTUI := flag.Bool("no-tui", false, "Run without the TUI, logging to stderr and printing every finished call")
+	selfTest := flag.Bool("selftest", false, "Send a tiny /api/generate request through the proxy to the target, print whether it worked and exit")
+	selfTestModel := flag.String("selftest-model", "", "Model for -selftest (default: the first model the target lists)")
+	format := flag.String("format", "text", "How -no-tui prints finished calls: "+strings.Join(callprinter.Formats, ", ")+" (json writes them to stdout)")
 	flag.Parse()
 
+	if *noBodies && *singleFlight {
+		log.Fatal("-single-flight matches requests by their body and cannot be combined with -no-bodies")
+	}
+	if len(redact) > 0 && *singleFlight {
+		log.Fatal("-single-flight matches requests by their stored body and cannot be combined with -redact")
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Listen != "" && !isFlagSet("listen") {
+		*listenAddr = cfg.Listen
+	}
+
+	theme, err := tui.LookupTheme(*themeName)
+	if err != nil {
+		log.Fatalf("Invalid -theme: %v", err)
+	}
+	if isFlagSet("format") && !*noTUI {
+		log.Fatal("-format only applies together with -no-tui")
+	}
+
 	// Create a context that will be canceled on interrupt
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -35,39 +133,250 @@ func main() {
 		cancel()
 	}()
 
+	if *name != "" {
+		log.SetPrefix(*name + " ")
+	}
+
 	// Initialize components
-	tracker := tracker.NewCallTracker(*maxCalls)
+	tracker := tracker.NewCallTracker(*maxCalls, *eventBuffer)
+	tracker.SetMaxMemory(int(maxMemory))
+	tracker.SetCompressHistory(*compressHistory)
+	if err := tracker.SetIDScheme(*callIDs); err != nil {
+		log.Fatalf("Invalid -call-ids: %v", err)
+	}
+	if *maxAge > 0 {
+		go tracker.ExpireCalls(*maxAge)
+	}
+
+	var accessLog *accesslog.Logger
+	if *accessLogPath != "" {
+		accessLog, err = accesslog.New(*accessLogPath, tracker, *name)
+		if err != nil {
+			log.Fatalf("Failed to open access log: %v", err)
+		}
+		defer accessLog.Close()
+		go accessLog.Run(tracker.Subscribe())
+	}
+
+	if *otelEndpoint != "" {
+		go tracing.NewExporter(*otelEndpoint, tracker).Run(tracker.Subscribe())
+	}
+
+	management := api.NewHandler(tracker)
+	var mainManagement http.Handler
+	if *apiOnMain {
+		mainManagement = management
+	}
+
+	var responseHooks []proxy.ResponseHook
+	if *proxyHeader {
+		responseHooks = append(responseHooks, proxy.AddProxyHeader)
+	}
+
+	streamRequestsOver := 0
+	if *noRequestBuffer {
+		streamRequestsOver = max(int(requestBufferLimit), 1)
+	}
 
 	// Create and start the proxy
-	proxy, err := proxy.NewProxy(*targetURL, tracker)
+	proxy, err := proxy.NewProxy(*targetURL, tracker, proxy.Options{
+		Management:         mainManagement,
+		TargetPathPrefix:   *targetPathPrefix,
+		UpstreamHost:       *upstreamHost,
+		Routes:             mergeRoutes(cfg, routes),
+		InterceptPaths:     cfg.InterceptPaths,
+		Tracing:            *otelEndpoint != "",
+		SingleFlight:       *singleFlight,
+		RateLimits:         rates,
+		Passthrough:        *passthrough,
+		ValidateRequests:   *validateRequests,
+		DropBodies:         *noBodies,
+		Redact:             redact,
+		CaptureHeaders:     *captureHeaders,
+		StreamIdleTimeout:  *streamIdleTimeout,
+		Verbose:            verbose,
+		MaxBody:            *maxBody,
+		TraceChunks:        *traceChunks,
+		ForwardedHeaders:   *forwardedHeaders,
+		MaxIdleConns:       *maxIdleConns,
+		MaxConnsPerHost:    *maxConnsPerHost,
+		IdleConnTimeout:    *idleConnTimeout,
+		HTTP2:              *useHTTP2,
+		ResponseHooks:      responseHooks,
+		Retry429:           *retry429,
+		Retry429MaxWait:    *retry429MaxWait,
+		StreamRequestsOver: streamRequestsOver,
+		CollapseStreams:    *collapseStream,
+		SynthStreams:       *synthStream,
+		SynthStreamDelay:   *synthStreamDelay,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create proxy: %v", err)
 	}
+	if *requireUpstream {
+		if err := proxy.CheckUpstream(ctx); err != nil {
+			log.Fatalf("Upstream %s is not reachable: %v", *targetURL, err)
+		}
+	}
 
-	server := &http.Server{
-		Addr:    *listenAddr,
-		Handler: proxy,
+	// Check the whole path through the proxy once instead of serving clients, exiting non-zero on failure
+	if *selfTest {
+		if !runSelfTest(ctx, proxy, tracker, *selfTestModel, *passthrough) {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Start the HTTP server in a goroutine
+	// On SIGHUP, reopen the access log so it can be rotated externally and reload the config
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 	go func() {
-		log.Printf("Starting proxy server on %s, forwarding to %s\n", *listenAddr, *targetURL)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+		for range hupChan {
+			if accessLog != nil {
+				if err := accessLog.Reopen(); err != nil {
+					log.Printf("ERROR: Failed to reopen access log: %v", err)
+				}
+			}
+			if *configPath != "" {
+				reloadConfig(*configPath, *listenAddr, routes, proxy)
+			}
 		}
 	}()
 
-	// Create and start the TUI in a goroutine
-	tuiApp := tui.NewTUI(tracker)
-	tuiDone := make(chan struct{})
-	go func() {
-		defer close(tuiDone)
-		if err := tuiApp.Run(); err != nil {
-			log.Printf("TUI error: %v", err)
+	// Bind every address before serving any, so that a taken one stops the start
+	addrs := listenAddrs(*listenAddr)
+	if len(addrs) == 0 {
+		log.Fatal("-listen needs at least one address")
+	}
+	listeners := make([]net.Listener, len(addrs))
+	for i, addr := range addrs {
+		if listeners[i], err = listen(addr); err != nil {
+			log.Fatalf("Failed to listen on %s: %v", addr, err)
 		}
-		// When TUI exits, cancel the context to trigger server shutdown
-		cancel()
-	}()
+	}
+
+	// Start one HTTP server per address, all sharing the proxy
+	servers := make([]*http.Server, len(addrs))
+	for i, addr := range addrs {
+		server := &http.Server{
+			Handler: proxy,
+		}
+		if *useHTTP2 {
+			// The listener has no TLS, so HTTP/2 clients have to use prior knowledge (h2c)
+			server.Protocols = new(http.Protocols)
+			server.Protocols.SetHTTP1(true)
+			server.Protocols.SetUnencryptedHTTP2(true)
+		}
+		servers[i] = server
+
+		go func() {
+			log.Printf("Starting proxy server on %s, forwarding to %s\n", addr, *targetURL)
+			if err := server.Serve(listeners[i]); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start server on %s: %v", addr, err)
+			}
+		}()
+	}
+
+	// Serve the management endpoints on their own listener, if requested
+	var apiServer *http.Server
+	if *apiListen != "" {
+		apiListener, err := listen(*apiListen)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", *apiListen, err)
+		}
+		apiServer = &http.Server{Handler: management}
+		go func() {
+			log.Printf("Starting management API on %s\n", *apiListen)
+			if err := apiServer.Serve(apiListener); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start management API: %v", err)
+			}
+		}()
+	}
+
+	// Serve the browser dashboard together with the management endpoints it polls, if requested
+	var webServer *http.Server
+	if *webListen != "" {
+		webListener, err := listen(*webListen)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", *webListen, err)
+		}
+		webServer = &http.Server{Handler: web.NewHandler(management)}
+		go func() {
+			log.Printf("Starting web dashboard on %s\n", *webListen)
+			if err := webServer.Serve(webListener); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start web dashboard: %v", err)
+			}
+		}()
+	}
+
+	// Calls without a captured or with a redacted body cannot be replayed or copied as curl
+	bodiesAltered := *noBodies || len(redact) > 0
+	replay := proxy.Replay
+	if bodiesAltered {
+		replay = nil
+	}
+
+	// Without the TUI, the printer consumes the tracker's events instead and the log stays on stderr
+	var tuiApp *tui.TUI
+	if *noTUI {
+		printer, err := callprinter.New(os.Stdout, tracker, *format)
+		if err != nil {
+			log.Fatalf("Invalid -format: %v", err)
+		}
+		go printer.Run(tracker.Events())
+	} else {
+		tuiApp = tui.NewTUI(tracker, tui.Options{
+			ListWidth:    *listWidth,
+			Theme:        &theme,
+			SaveUIState:  *saveUIState,
+			Replay:       replay,
+			Mouse:        *mouse,
+			FollowActive: *follow,
+			LogLines:     *logLines,
+			LogBuffer:    *logBuffer,
+			Name:         *name,
+			CurlBase:     *curlBase,
+			NoCurl:       bodiesAltered,
+			TimeFormat:   *timeFormat,
+			UTC:          *utc,
+		})
+	}
+
+	// Warn about an unreachable upstream without refusing to start, it may come up later, and keep watching it.
+	// This runs after the TUI took over the log so that the warnings show up in the log view.
+	if *healthInterval > 0 {
+		down := false
+		go proxy.MonitorUpstream(ctx, *healthInterval, func(up bool, err error) {
+			if tuiApp != nil {
+				tuiApp.SetUpstreamUp(up)
+			}
+			if !up {
+				log.Printf("WARN: Upstream %s is not reachable, requests will fail until it is up: %v", *targetURL, err)
+			} else if down {
+				log.Printf("Upstream %s is reachable again", *targetURL)
+			}
+			down = !up
+		})
+	} else if !*requireUpstream {
+		go func() {
+			if err := proxy.CheckUpstream(ctx); err != nil {
+				log.Printf("WARN: Upstream %s is not reachable, requests will fail until it is up: %v", *targetURL, err)
+			}
+		}()
+	}
+
+	// Start the TUI in a goroutine
+	tuiDone := make(chan struct{})
+	if tuiApp != nil {
+		go func() {
+			defer close(tuiDone)
+			if err := tuiApp.Run(); err != nil {
+				log.Printf("ERROR: TUI error: %v", err)
+			}
+			// When TUI exits, cancel the context to trigger server shutdown
+			cancel()
+		}()
+	}
 
 	// Wait for either context cancellation or TUI exit
 	select {
@@ -77,10 +386,156 @@ func main() {
 		// TUI was closed by user
 	}
 
-	// Shutdown the server
+	// Shutdown the servers, together so that one waiting for its calls does not hold up the others
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Error during server shutdown: %v", err)
+	var shutdown sync.WaitGroup
+	for i, server := range servers {
+		shutdown.Add(1)
+		go func() {
+			defer shutdown.Done()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("ERROR: Server shutdown on %s failed: %v", addrs[i], err)
+			}
+		}()
+	}
+	shutdown.Wait()
+	if apiServer != nil {
+		if err := apiServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("ERROR: Management API shutdown failed: %v", err)
+		}
+	}
+	if webServer != nil {
+		if err := webServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("ERROR: Web dashboard shutdown failed: %v", err)
+		}
+	}
+}
+
+// isFlagSet reports whether the flag was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// listenAddrs splits the comma-separated -listen value into its addresses
+func listenAddrs(value string) []string {
+	var addrs []string
+	for addr := range strings.SplitSeq(value, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// listen opens a listener for -listen, which is either a TCP address or unix:/path/to.sock
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// The socket file is removed again when the server closes the listener on shutdown
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// routeFlag collects repeated -route model=url flags
+type routeFlag map[string]string
+
+func (f routeFlag) String() string {
+	rules := make([]string, 0, len(f))
+	for model, upstream := range f {
+		rules = append(rules, model+"="+upstream)
+	}
+	sort.Strings(rules)
+	return strings.Join(rules, ",")
+}
+
+func (f routeFlag) Set(value string) error {
+	model, upstream, ok := strings.Cut(value, "=")
+	if !ok || model == "" || upstream == "" {
+		return fmt.Errorf("expected model=url, got %q", value)
+	}
+	f[model] = upstream
+	return nil
+}
+
+// rateFlag collects -rate endpoint=N/unit limits, comma-separated or repeated, as requests per second
+type rateFlag map[string]float64
+
+func (f rateFlag) String() string {
+	rules := make([]string, 0, len(f))
+	for endpoint, rate := range f {
+		rules = append(rules, fmt.Sprintf("%s=%g/s", endpoint, rate))
+	}
+	sort.Strings(rules)
+	return strings.Join(rules, ",")
+}
+
+func (f rateFlag) Set(value string) error {
+	for _, rule := range strings.Split(value, ",") {
+		endpoint, limit, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		count, unit, hasUnit := strings.Cut(limit, "/")
+		n, err := strconv.ParseFloat(count, 64)
+		if !ok || endpoint == "" || !hasUnit || err != nil || n <= 0 {
+			return fmt.Errorf("expected endpoint=N/s, N/m or N/h, got %q", rule)
+		}
+		per, ok := map[string]float64{"s": 1, "m": 60, "h": 3600}[unit]
+		if !ok {
+			return fmt.Errorf("unknown unit %q in %q, expected s, m or h", unit, rule)
+		}
+		f[endpoint] = n / per
+	}
+	return nil
+}
+
+// redactFlag collects repeated -redact regular expressions
+type redactFlag []*regexp.Regexp
+
+func (f *redactFlag) String() string {
+	patterns := make([]string, len(*f))
+	for i, pattern := range *f {
+		patterns[i] = pattern.String()
+	}
+	return strings.Join(patterns, ",")
+}
+
+func (f *redactFlag) Set(value string) error {
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, pattern)
+	return nil
+}
+
+// byteSizeFlag parses a size in bytes with an optional KB, MB or GB suffix (powers of 1024)
+type byteSizeFlag int
+
+func (f *byteSizeFlag) String() string {
+	return strconv.Itoa(int(*f))
+}
+
+func (f *byteSizeFlag) Set(value string) error {
+	number := strings.ToUpper(strings.TrimSpace(value))
+	unit := 1
+	for _, suffix := range []struct {
+		name string
+		size int
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}} {
+		if trimmed, ok := strings.CutSuffix(number, suffix.name); ok {
+			number, unit = strings.TrimSpace(trimmed), suffix.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("expected a size such as 512MB, got %q", value)
 	}
+	*f = byteSizeFlag(n * float64(unit))
+	return nil
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
+)
+
+// selfTestTimeout bounds the whole self-test, including loading the model on the target
+const selfTestTimeout = 2 * time.Minute
+
+// selfTestCheck is one line of the self-test summary
+type selfTestCheck struct {
+	name   string
+	err    error
+	detail string
+}
+
+// runSelfTest serves the proxy on a loopback port of its own and sends a tiny streaming /api/generate request
+// through it, then prints whether forwarding, streaming, completion and interception worked. Without a model,
+// the first one the target lists in /api/tags is used. It reports whether every check passed.
+func runSelfTest(ctx context.Context, handler http.Handler, tracker *tracker.CallTracker, model string, passthrough bool) bool {
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	// The tracker is otherwise drained by the TUI or the printer, finished calls are handed over here
+	done := make(chan string, 16)
+	go func() {
+		for event := range tracker.Events() {
+			if event.Done {
+				select {
+				case done <- event.ID:
+				default:
+				}
+			}
+		}
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Printf("FAIL  setup         %v\n", err)
+		return false
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	defer server.Close()
+	base := "http://" + listener.Addr().String()
+
+	if model == "" {
+		if model, err = firstModel(ctx, base); err != nil {
+			fmt.Printf("FAIL  setup         no model to test with, set -selftest-model: %v\n", err)
+			return false
+		}
+	}
+	fmt.Printf("Self-test of the proxy with model %s\n", model)
+
+	checks := selfTestGenerate(ctx, base, model)
+	if failed(checks) {
+		checks = append(checks, selfTestCheck{name: "interception", err: errors.New("skipped, the request failed")})
+	} else if passthrough {
+		checks = append(checks, selfTestCheck{name: "interception", detail: "skipped, -passthrough is set"})
+	} else {
+		checks = append(checks, selfTestInterception(ctx, tracker, done))
+	}
+
+	for _, check := range checks {
+		if check.err != nil {
+			fmt.Printf("FAIL  %-13s %v\n", check.name, check.err)
+		} else {
+			fmt.Printf("PASS  %-13s %s\n", check.name, check.detail)
+		}
+	}
+	if failed(checks) {
+		fmt.Println("Self-test failed")
+		return false
+	}
+	fmt.Println("Self-test passed")
+	return true
+}
+
+func failed(checks []selfTestCheck) bool {
+	for _, check := range checks {
+		if check.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// firstModel returns the first model installed on the target, asked through the proxy
+func firstModel(ctx context.Context, base string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/api/tags", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("/api/tags answered %s", resp.Status)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return "", fmt.Errorf("reading /api/tags: %w", err)
+	}
+	if len(tags.Models) == 0 {
+		return "", errors.New("the target has no models installed")
+	}
+	return tags.Models[0].Name, nil
+}
+
+// selfTestGenerate sends the streaming generate request and checks the response the client sees
+func selfTestGenerate(ctx context.Context, base, model string) []selfTestCheck {
+	body, _ := json.Marshal(map[string]any{
+		"model":   model,
+		"prompt":  "Say hello.",
+		"stream":  true,
+		"options": map[string]any{"num_predict": 8},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return []selfTestCheck{{name: "forwarding", err: err}}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return []selfTestCheck{{name: "forwarding", err: err}}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return []selfTestCheck{{name: "forwarding", err: fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))}}
+	}
+	checks := []selfTestCheck{{name: "forwarding", detail: resp.Status}}
+
+	var chunks int
+	var last struct {
+		Done  bool   `json:"done"`
+		Error string `json:"error"`
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		chunks++
+		last.Done, last.Error = false, ""
+		if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			return append(checks, selfTestCheck{name: "streaming", err: fmt.Errorf("chunk %d is not JSON: %v", chunks, err)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return append(checks, selfTestCheck{name: "streaming", err: fmt.Errorf("after %d chunks: %v", chunks, err)})
+	}
+	if chunks < 2 {
+		checks = append(checks, selfTestCheck{name: "streaming", err: fmt.Errorf("the response was not streamed (%d chunks)", chunks)})
+	} else {
+		checks = append(checks, selfTestCheck{name: "streaming", detail: fmt.Sprintf("%d chunks", chunks)})
+	}
+
+	switch {
+	case last.Error != "":
+		checks = append(checks, selfTestCheck{name: "completion", err: errors.New(last.Error)})
+	case !last.Done:
+		checks = append(checks, selfTestCheck{name: "completion", err: errors.New("the stream ended without a done chunk")})
+	default:
+		checks = append(checks, selfTestCheck{name: "completion", detail: "done after " + time.Since(start).Round(time.Millisecond).String()})
+	}
+	return checks
+}
+
+// selfTestInterception checks that the generate call was tracked and finished as done
+func selfTestInterception(ctx context.Context, tracker *tracker.CallTracker, done <-chan string) selfTestCheck {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return selfTestCheck{name: "interception", err: errors.New("the call was not tracked as finished")}
+		case id := <-done:
+			call, ok := tracker.GetCall(id)
+			if !ok || !strings.HasSuffix(call.Endpoint, "/api/generate") {
+				continue
+			}
+			snapshot := call.Snapshot()
+			if snapshot.Status != types.StatusDone {
+				return selfTestCheck{name: "interception", err: fmt.Errorf("call %s was tracked as %s", id, snapshot.Status)}
+			}
+			return selfTestCheck{name: "interception", detail: fmt.Sprintf("call %s tracked as done, %d prompt and %d completion tokens",
+				id, snapshot.PromptTokens, snapshot.CompletionTokens)}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
+)
+
+// entry is one line of the access log
+type entry struct {
+	Time             time.Time        `json:"time"`
+	ID               string           `json:"id"`
+	ClientIP         string           `json:"client_ip,omitempty"`
+	Method           string           `json:"method"`
+	Endpoint         string           `json:"endpoint"`
+	Model            string           `json:"model,omitempty"`
+	Status           types.CallStatus `json:"status"`
+	StatusCode       int              `json:"status_code,omitempty"`
+	DurationMs       int64            `json:"duration_ms"`
+	PromptTokens     int              `json:"prompt_tokens"`
+	CompletionTokens int              `json:"completion_tokens"`
+	Error            string           `json:"error,omitempty"`
+	Instance         string           `json:"instance,omitempty"`
+}
+
+// Logger appends every finished call as one JSON object per line to a file
+type Logger struct {
+	path     string
+	tracker  *tracker.CallTracker
+	instance string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// New opens the access log at path for appending. A non-empty instance name is added to every entry.
+func New(path string, tracker *tracker.CallTracker, instance string) (*Logger, error) {
+	l := &Logger{
+		path:     path,
+		tracker:  tracker,
+		instance: instance,
+	}
+	if err := l.Reopen(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reopen closes and reopens the log file, so external tools like logrotate can move it away
+func (l *Logger) Reopen() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	return nil
+}
+
+// Close closes the log file
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Run writes an entry for every call that finishes, until the events channel is closed
+func (l *Logger) Run(events <-chan types.Event) {
+	for event := range events {
+		if !event.Done {
+			continue
+		}
+		call, ok := l.tracker.GetCall(event.ID)
+		if !ok {
+			continue
+		}
+		if err := l.write(call); err != nil {
+			log.Printf("ERROR: Failed to write access log: %v", err)
+		}
+	}
+}
+
+func (l *Logger) write(call *types.Call) error {
+	c := call.Snapshot()
+	line, err := json.Marshal(entry{
+		Time:             c.StartTime,
+		ID:               c.ID,
+		ClientIP:         c.ClientIP,
+		Method:           c.Method,
+		Endpoint:         c.Endpoint,
+		Model:            c.Model,
+		Status:           c.Status,
+		StatusCode:       c.StatusCode,
+		DurationMs:       c.DurationMs,
+		PromptTokens:     c.PromptTokens,
+		CompletionTokens: c.CompletionTokens,
+		Error:            c.Error,
+		Instance:         l.instance,
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
+)
+
+// callField is a call snapshot field by its index, and whether it is left out of the JSON when empty
+type callField struct {
+	index     int
+	omitEmpty bool
+}
+
+// callFields are the call snapshot fields by their JSON names, accepted by ?fields=
+var callFields = func() map[string]callField {
+	fields := make(map[string]callField)
+	typ := reflect.TypeFor[types.CallSnapshot]()
+	for i := range typ.NumField() {
+		name, options, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		fields[name] = callField{index: i, omitEmpty: options == "omitempty"}
+	}
+	return fields
+}()
+
+// callQuery holds the options of the calls endpoints:
+// ?fields=a,b selects the fields to return and ?response_text=true replaces the
+// raw response stream with the assistant text
+type callQuery struct {
+	fields       []string
+	responseText bool
+}
+
+func parseCallQuery(r *http.Request) (callQuery, error) {
+	var q callQuery
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.TrimSpace(field)
+			if _, ok := callFields[field]; !ok {
+				return q, fmt.Errorf("unknown field %q", field)
+			}
+			q.fields = append(q.fields, field)
+		}
+	}
+	q.responseText = r.URL.Query().Get("response_text") == "true"
+	return q, nil
+}
+
+// wantsBodies reports whether the request or the response is among the selected fields
+func (q callQuery) wantsBodies() bool {
+	return len(q.fields) == 0 || slices.Contains(q.fields, "request") || slices.Contains(q.fields, "response")
+}
+
+// render converts a call into its JSON representation according to the query. The bodies are only
+// copied if they are selected.
+func (q callQuery) render(call *types.Call) any {
+	var c types.CallSnapshot
+	if q.wantsBodies() {
+		c = call.Snapshot()
+	} else {
+		c = call.SnapshotWithoutBodies()
+	}
+	if q.responseText {
+		c.Response = types.ResponseText(c.Response)
+	}
+	if len(q.fields) == 0 {
+		return c
+	}
+
+	value := reflect.ValueOf(c)
+	selected := make(map[string]any, len(q.fields))
+	for _, name := range q.fields {
+		field := callFields[name]
+		v := value.Field(field.index)
+		if field.omitEmpty && isEmptyValue(v) {
+			continue
+		}
+		selected[name] = v.Interface()
+	}
+	return selected
+}
+
+// isEmptyValue reports whether encoding/json leaves out a value of an omitempty field
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Struct:
+		return false
+	}
+	return v.IsZero()
+}
+
+// stats is the JSON representation of the session summary served by /stats
+type stats struct {
+	Calls            int                      `json:"calls"`
+	ByStatus         map[types.CallStatus]int `json:"by_status"`
+	RetainedBytes    int                      `json:"retained_bytes"`
+	EvictedCalls     int                      `json:"evicted_calls"`
+	DroppedEvents    int                      `json:"dropped_events"`
+	GeneratedTokens  int                      `json:"generated_tokens"`
+	TransferredBytes int                      `json:"transferred_bytes"`
+	UptimeSeconds    int64                    `json:"uptime_seconds"`
+}
+
+func newStats(summary tracker.Summary) stats {
+	return stats{
+		Calls: summary.Total,
+		ByStatus: map[types.CallStatus]int{
+			types.StatusActive:       summary.Active,
+			types.StatusDone:         summary.Done(),
+			types.StatusError:        summary.Errors,
+			types.StatusDisconnected: summary.Disconnected,
+			types.StatusRateLimited:  summary.RateLimited,
+		},
+		RetainedBytes:    summary.RetainedBytes,
+		EvictedCalls:     summary.EvictedCalls,
+		DroppedEvents:    summary.DroppedEvents,
+		GeneratedTokens:  summary.GeneratedTokens,
+		TransferredBytes: summary.TransferredBytes,
+		UptimeSeconds:    int64(summary.Uptime.Seconds()),
+	}
+}
+
+// NewHandler returns the management API: /healthz, /metrics, /stats, /calls, /calls/{id} and its plain text views
+func NewHandler(tracker *tracker.CallTracker) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("GET /calls", func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseCallQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		calls := tracker.GetCalls()
+		result := make([]any, 0, len(calls))
+		for _, call := range calls {
+			result = append(result, q.render(call))
+		}
+		writeJSON(w, result)
+	})
+
+	mux.HandleFunc("GET /calls/{id}", func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseCallQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		call, ok := tracker.GetCall(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "call not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, q.render(call))
+	})
+
+	mux.HandleFunc("GET /calls/{id}/request.txt", func(w http.ResponseWriter, r *http.Request) {
+		call, ok := tracker.GetCall(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "call not found", http.StatusNotFound)
+			return
+		}
+		writeText(w, call.RequestText())
+	})
+
+	mux.HandleFunc("GET /calls/{id}/response.txt", func(w http.ResponseWriter, r *http.Request) {
+		call, ok := tracker.GetCall(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "call not found", http.StatusNotFound)
+			return
+		}
+		if call.IsActive() {
+			http.Error(w, "call is still active", http.StatusTooEarly)
+			return
+		}
+		writeText(w, call.ResponseText())
+	})
+
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, newStats(tracker.Summary()))
+	})
+
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		writeMetrics(w, tracker.Summary())
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// writeText writes plain text ending with a newline, so that it can be piped like command output
+func writeText(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	fmt.Fprint(w, text)
+}
+
+// writeMetrics renders the session summary in the Prometheus text format
+func writeMetrics(w http.ResponseWriter, summary tracker.Summary) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP ollama_proxy_calls Calls in the history by status.")
+	fmt.Fprintln(w, "# TYPE ollama_proxy_calls gauge")
+	fmt.Fprintf(w, "ollama_proxy_calls{status=%q} %d\n", types.StatusActive, summary.Active)
+	fmt.Fprintf(w, "ollama_proxy_calls{status=%q} %d\n", types.StatusDone, summary.Done())
+	fmt.Fprintf(w, "ollama_proxy_calls{status=%q} %d\n", types.StatusError, summary.Errors)
+	fmt.Fprintf(w, "ollama_proxy_calls{status=%q} %d\n", types.StatusDisconnected, summary.Disconnected)
+	fmt.Fprintf(w, "ollama_proxy_calls{status=%q} %d\n", types.StatusRateLimited, summary.RateLimited)
+
+	fmt.Fprintln(w, "# HELP ollama_proxy_generated_tokens_total Completion tokens generated since startup.")
+	fmt.Fprintln(w, "# TYPE ollama_proxy_generated_tokens_total counter")
+	fmt.Fprintf(w, "ollama_proxy_generated_tokens_total %d\n", summary.GeneratedTokens)
+
+	fmt.Fprintln(w, "# HELP ollama_proxy_transferred_bytes_total Request and response bytes since startup.")
+	fmt.Fprintln(w, "# TYPE ollama_proxy_transferred_bytes_total counter")
+	fmt.Fprintf(w, "ollama_proxy_transferred_bytes_total %d\n", summary.TransferredBytes)
+
+	fmt.Fprintln(w, "# HELP ollama_proxy_retained_bytes Request and response bytes kept in the history.")
+	fmt.Fprintln(w, "# TYPE ollama_proxy_retained_bytes gauge")
+	fmt.Fprintf(w, "ollama_proxy_retained_bytes %d\n", summary.RetainedBytes)
+
+	fmt.Fprintln(w, "# HELP ollama_proxy_evicted_calls_total Calls removed from the history to make room or because they expired.")
+	fmt.Fprintln(w, "# TYPE ollama_proxy_evicted_calls_total counter")
+	fmt.Fprintf(w, "ollama_proxy_evicted_calls_total %d\n", summary.EvictedCalls)
+
+	fmt.Fprintln(w, "# HELP ollama_proxy_dropped_events_total Progress events dropped because a consumer fell behind.")
+	fmt.Fprintln(w, "# TYPE ollama_proxy_dropped_events_total counter")
+	fmt.Fprintf(w, "ollama_proxy_dropped_events_total %d\n", summary.DroppedEvents)
+}
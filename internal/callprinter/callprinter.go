@@ -0,0 +1,83 @@
+package callprinter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{"text", "json"}
+
+// Printer reports every finished call when running without the TUI: as a log line in the text format,
+// or as its full snapshot, one JSON object per line, in the json format
+type Printer struct {
+	tracker *tracker.CallTracker
+	json    bool
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// New creates a printer writing JSON to out; text lines go to the standard logger
+func New(out io.Writer, tracker *tracker.CallTracker, format string) (*Printer, error) {
+	switch format {
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected text or json", format)
+	}
+	return &Printer{
+		tracker: tracker,
+		json:    format == "json",
+		out:     out,
+	}, nil
+}
+
+// Run prints every call that finishes, until the events channel is closed
+func (p *Printer) Run(events <-chan types.Event) {
+	for event := range events {
+		if !event.Done {
+			continue
+		}
+		call, ok := p.tracker.GetCall(event.ID)
+		if !ok {
+			continue
+		}
+		if err := p.print(call.Snapshot()); err != nil {
+			log.Printf("ERROR: Failed to print call %s: %v", call.ID, err)
+		}
+	}
+}
+
+func (p *Printer) print(call types.CallSnapshot) error {
+	if !p.json {
+		log.Printf("Call %s: %s %s %s %s (%d) in %s, %d prompt and %d completion tokens%s", call.ID, call.Method,
+			call.Endpoint, call.Model, call.Status, call.StatusCode, time.Duration(call.DurationMs)*time.Millisecond,
+			call.PromptTokens, call.CompletionTokens, errorSuffix(call.Error))
+		return nil
+	}
+
+	line, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+
+	// One write per line, so that a collector never sees a partial object
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.out.Write(append(line, '\n'))
+	return err
+}
+
+func errorSuffix(message string) string {
+	if message == "" {
+		return ""
+	}
+	return ": " + message
+}
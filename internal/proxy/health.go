@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"context"
+	"time"
+)
+
+// MonitorUpstream probes the default upstream with CheckUpstream every interval until ctx is done. It calls
+// report with the result of the first probe and again whenever the upstream goes down or comes back up.
+func (p *Proxy) MonitorUpstream(ctx context.Context, interval time.Duration, report func(up bool, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	first, wasUp := true, false
+	for {
+		err := p.CheckUpstream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if up := err == nil; first || up != wasUp {
+			report(up, err)
+			first, wasUp = false, up
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import "net/http"
+
+// RequestHook inspects or changes a request after it was directed to its upstream and before it is sent.
+// Returning an error answers the request with 502 Bad Gateway instead.
+type RequestHook func(*http.Request) error
+
+// hookTransport runs the request hooks on every outgoing request. The request is the copy
+// httputil.ReverseProxy made for the upstream, so hooks may modify it.
+type hookTransport struct {
+	base  http.RoundTripper
+	hooks []RequestHook
+}
+
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, hook := range t.hooks {
+		if err := hook(req); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// ResponseHook inspects or changes an upstream response before it is passed on to the client.
+// Returning an error aborts the response with 502 Bad Gateway.
+type ResponseHook func(*http.Response) error
+
+// ProxyHeader is set on responses by AddProxyHeader
+const ProxyHeader = "X-Ollama-Proxy"
+
+// AddProxyHeader is a ResponseHook that marks responses as having passed through the proxy
+func AddProxyHeader(resp *http.Response) error {
+	resp.Header.Set(ProxyHeader, "1")
+	return nil
+}
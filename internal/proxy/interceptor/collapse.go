@@ -0,0 +1,139 @@
+package interceptor
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CollapseHeader and CollapseParam let a client ask for a streamed response as one object, with CollapseStreams
+const (
+	CollapseHeader = "X-Ollama-Proxy-Collapse"
+	CollapseParam  = "collapse_stream"
+)
+
+// wantsCollapse reports whether the client asked for the response as one object, with a true CollapseHeader
+// or CollapseParam
+func wantsCollapse(r *http.Request) bool {
+	for _, value := range []string{r.Header.Get(CollapseHeader), r.URL.Query().Get(CollapseParam)} {
+		if on, err := strconv.ParseBool(value); err == nil && on {
+			return true
+		}
+	}
+	return false
+}
+
+// stripCollapse removes the request for a collapsed response, so that it is not passed upstream
+func stripCollapse(r *http.Request) {
+	r.Header.Del(CollapseHeader)
+	if query := r.URL.Query(); query.Has(CollapseParam) {
+		query.Del(CollapseParam)
+		r.URL.RawQuery = query.Encode()
+	}
+}
+
+// isNDJSONContentType reports whether a response of the content type is an Ollama stream
+func isNDJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/x-ndjson" || mediaType == "application/ndjson")
+}
+
+// streamCollapser merges the objects of a streamed chat or generate response into the one object Ollama
+// answers with when streaming is off: the text of all chunks with the final chunk's stats
+type streamCollapser struct {
+	raw     []byte
+	invalid bool // an object was not JSON, the stream is passed on as it came
+
+	last      map[string]json.RawMessage
+	lastRaw   []byte
+	chat      bool
+	role      string
+	response  strings.Builder
+	content   strings.Builder
+	thinking  strings.Builder
+	toolCalls []json.RawMessage
+}
+
+// add takes in the next object of the stream
+func (c *streamCollapser) add(object []byte) {
+	c.raw = append(c.raw, object...)
+	if strings.TrimSpace(string(object)) == "" {
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	var chunk struct {
+		Response string `json:"response"`
+		Thinking string `json:"thinking"`
+		Message  *struct {
+			Role      string            `json:"role"`
+			Content   string            `json:"content"`
+			Thinking  string            `json:"thinking"`
+			ToolCalls []json.RawMessage `json:"tool_calls"`
+		} `json:"message"`
+	}
+	if json.Unmarshal(object, &fields) != nil || json.Unmarshal(object, &chunk) != nil {
+		c.invalid = true
+		return
+	}
+
+	c.last, c.lastRaw = fields, slices.Clone(object)
+	c.response.WriteString(chunk.Response)
+	c.thinking.WriteString(chunk.Thinking)
+	if msg := chunk.Message; msg != nil {
+		c.chat = true
+		if c.role == "" {
+			c.role = msg.Role
+		}
+		c.content.WriteString(msg.Content)
+		c.thinking.WriteString(msg.Thinking)
+		c.toolCalls = append(c.toolCalls, msg.ToolCalls...)
+	}
+}
+
+// result returns the merged object. An error the stream ended with is returned as it is.
+func (c *streamCollapser) result() []byte {
+	if c.invalid || c.last == nil {
+		return c.raw
+	}
+	if _, ok := c.last["error"]; ok {
+		return c.lastRaw
+	}
+
+	merged := c.last
+	if c.chat {
+		message := make(map[string]json.RawMessage)
+		json.Unmarshal(merged["message"], &message)
+		message["role"] = marshalRaw(c.role)
+		message["content"] = marshalRaw(c.content.String())
+		delete(message, "thinking")
+		if c.thinking.Len() > 0 {
+			message["thinking"] = marshalRaw(c.thinking.String())
+		}
+		delete(message, "tool_calls")
+		if len(c.toolCalls) > 0 {
+			message["tool_calls"] = marshalRaw(c.toolCalls)
+		}
+		merged["message"] = marshalRaw(message)
+	} else {
+		merged["response"] = marshalRaw(c.response.String())
+		delete(merged, "thinking")
+		if c.thinking.Len() > 0 {
+			merged["thinking"] = marshalRaw(c.thinking.String())
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return c.raw
+	}
+	return append(data, '\n')
+}
+
+func marshalRaw(v any) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
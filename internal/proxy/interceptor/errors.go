@@ -0,0 +1,41 @@
+package interceptor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// WriteError answers a request the proxy could not serve itself with a JSON error body clients can parse:
+// OpenAI's error envelope on the OpenAI-compatible /v1/ routes, Ollama's {"error": ...} everywhere else.
+// The detail, e.g. the underlying network error, is left out when empty.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, message, detail string) {
+	var body any
+	if strings.Contains(r.URL.Path, "/v1/") {
+		if detail != "" {
+			message += ": " + detail
+		}
+		errorType := "api_error"
+		if status < 500 {
+			errorType = "invalid_request_error"
+		}
+		body = map[string]any{"error": map[string]any{
+			"message": message,
+			"type":    errorType,
+			"param":   nil,
+			"code":    nil,
+		}}
+	} else {
+		obj := map[string]string{"error": message}
+		if detail != "" {
+			obj["detail"] = detail
+		}
+		body = obj
+	}
+
+	data, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
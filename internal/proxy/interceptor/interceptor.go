@@ -2,11 +2,23 @@ package interceptor
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"ollama-proxy/internal/tracing"
 	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
 )
 
 // CallAwareResponse represents a response writer associated with a tracked call.
@@ -18,63 +30,419 @@ type CallAwareResponse interface {
 }
 
 // AsCallAwareResponse attempts to extract a CallAwareResponse from a response writer.
+// Wrapping writers are looked through if they provide an Unwrap method.
 func AsCallAwareResponse(w http.ResponseWriter) (CallAwareResponse, bool) {
-	if fw, ok := w.(*responseForwarder); ok {
-		return fw, true
+	for {
+		switch rw := w.(type) {
+		case *responseForwarder:
+			return rw, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil, false
+		}
 	}
-	return nil, false
 }
 
+type replayKey struct{}
+
+// WithReplayOf marks requests made with the returned context as a replay of the given call
+func WithReplayOf(ctx context.Context, callID string) context.Context {
+	return context.WithValue(ctx, replayKey{}, callID)
+}
+
+// Options configures optional interceptor behavior
+type Options struct {
+	// CaptureHeaders stores the request and response headers on each call
+	CaptureHeaders bool
+
+	// StreamIdleTimeout aborts calls whose response stalls for longer than this; zero disables it
+	StreamIdleTimeout time.Duration
+
+	// InterceptPaths lists the endpoint suffixes to intercept; empty means DefaultInterceptPaths
+	InterceptPaths []string
+
+	// Tracing assigns every call a span in the incoming or a new trace and propagates it upstream
+	Tracing bool
+
+	// Passthrough disables interception entirely, every request is forwarded untouched
+	Passthrough bool
+
+	// ValidateRequests checks chat and generate request bodies and records warnings on the call
+	ValidateRequests bool
+
+	// DropBodies tracks calls without keeping their request and response bodies
+	DropBodies bool
+
+	// Redact lists patterns replaced by RedactedText in the stored bodies; forwarded data is left alone.
+	// Response objects are redacted one by one, so a match split across streamed objects is kept.
+	Redact []*regexp.Regexp
+
+	// TraceChunks logs every response object with its size and the time since the previous one
+	TraceChunks bool
+
+	// MaxBody caps the number of bytes of each body written to the log; zero means no limit
+	MaxBody int
+
+	// StreamRequestsOver forwards request bodies larger than this many bytes while they are read instead of
+	// buffering them first. Their body is not captured. Zero buffers every request.
+	StreamRequestsOver int
+
+	// CollapseStreams lets clients ask for a streamed response as one object with CollapseHeader or
+	// CollapseParam. The call is still tracked as it streams.
+	CollapseStreams bool
+
+	// SynthStreams sends a complete response to a chat or generate request that asked for a stream in
+	// word-sized pieces, SynthStreamDelay apart, for backends that do not stream
+	SynthStreams     bool
+	SynthStreamDelay time.Duration
+}
+
+// RedactedText replaces matches of the redaction patterns
+const RedactedText = "[REDACTED]"
+
+// DefaultInterceptPaths are the endpoints intercepted unless configured otherwise
+var DefaultInterceptPaths = []string{"/api/chat", "/api/generate", "/api/version", "/api/tags", "/api/show", "/api/ps"}
+
 // Interceptor handles request/response interception and tracking
 type Interceptor struct {
 	tracker *tracker.CallTracker
+	opts    Options
+
+	paths   []string
+	pathsMu sync.RWMutex
+
+	threads *threadIndex
 }
 
 // NewInterceptor creates a new interceptor instance
-func NewInterceptor(tracker *tracker.CallTracker) *Interceptor {
-	return &Interceptor{
+func NewInterceptor(tracker *tracker.CallTracker, opts Options) *Interceptor {
+	i := &Interceptor{
 		tracker: tracker,
+		opts:    opts,
+		threads: newThreadIndex(),
 	}
+	i.SetPaths(opts.InterceptPaths)
+	return i
 }
 
-// ShouldIntercept determines if a request should be intercepted
+// SetPaths replaces the endpoint suffixes to intercept, falling back to DefaultInterceptPaths when empty
+func (i *Interceptor) SetPaths(paths []string) {
+	if len(paths) == 0 {
+		paths = DefaultInterceptPaths
+	}
+	i.pathsMu.Lock()
+	i.paths = slices.Clone(paths)
+	i.pathsMu.Unlock()
+}
+
+// sensitiveHeaders are redacted when capturing headers
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// redactHeaders returns a copy of the headers with sensitive values replaced
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if values, ok := redacted[name]; ok {
+			for i := range values {
+				values[i] = "<redacted>"
+			}
+		}
+	}
+	return redacted
+}
+
+// ShouldIntercept determines if a request should be intercepted.
+// Protocol upgrades such as WebSockets are passed through untouched.
 func (i *Interceptor) ShouldIntercept(r *http.Request) bool {
-	return strings.HasSuffix(r.URL.Path, "/api/chat") || strings.HasSuffix(r.URL.Path, "/api/generate")
+	if i.opts.Passthrough || isUpgrade(r) {
+		return false
+	}
+
+	i.pathsMu.RLock()
+	defer i.pathsMu.RUnlock()
+	for _, path := range i.paths {
+		if strings.HasSuffix(r.URL.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUpgrade reports whether the client asks to switch to another protocol
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return true
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // InterceptRequest processes the request and returns a response writer that tracks the response
 func (i *Interceptor) InterceptRequest(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, string) {
-	// Read the full request body
-	bodyBytes, err := io.ReadAll(r.Body)
+	// Read the full request body, or only the start of a large one that is streamed
+	bodyBytes, body, streamed, err := i.readBody(r)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, "error reading request body", err.Error())
 		return nil, nil, ""
 	}
 
-	// Restore the request body for the proxy
-	req := r.Clone(r.Context())
-	req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-
 	// Create a call in the tracker with the captured request body
-	call := i.tracker.NewCall(r.Method, r.URL.Path, string(bodyBytes))
+	model := requestModel(bodyBytes)
+	replayOf, _ := r.Context().Value(replayKey{}).(string)
+	ip := clientIP(r)
+	var warnings []string
+	if i.opts.ValidateRequests && !streamed {
+		warnings = validateRequest(r.URL.Path, bodyBytes)
+	}
+	stored := i.storedBody(bodyBytes)
+	bytesIn := len(bodyBytes)
+	// The body is parsed before creating the call, whose init runs under the tracker's lock
+	promptEstimate := 0
+	var history []uint64
+	if streamed {
+		model = headModel(bodyBytes)
+		stored = ""
+		bytesIn = max(bytesIn, int(r.ContentLength))
+		warnings = append(warnings, fmt.Sprintf("request body larger than %d bytes was streamed upstream without being captured", i.opts.StreamRequestsOver))
+	} else {
+		promptEstimate = estimatePromptTokens(bodyBytes)
+		history = historyHashes(ip, model, bodyBytes)
+	}
+	call := i.tracker.NewCall(r.Method, r.URL.Path, stored, func(c *types.Call) {
+		c.BytesIn = bytesIn
+		c.Model = model
+		c.ReplayOf = replayOf
+		c.ClientIP = ip
+		c.RequestStreamed = streamed
+		if streamed {
+			c.ThreadID = c.ID
+		} else {
+			c.PromptEstimate = promptEstimate
+			c.ThreadID = i.threads.assign(c.ID, history)
+		}
+		c.UserAgent = r.UserAgent()
+		c.Warnings = warnings
+		if i.opts.CaptureHeaders {
+			c.RequestHeaders = redactHeaders(r.Header)
+		}
+		if i.opts.Tracing {
+			c.TraceID, c.ParentSpanID, _ = tracing.ParseTraceparent(r.Header.Get("traceparent"))
+			if c.TraceID == "" {
+				c.TraceID = tracing.NewTraceID()
+			}
+			c.SpanID = tracing.NewSpanID()
+		}
+	})
+
+	for _, warning := range warnings {
+		log.Printf("WARN: Call %s: %s", call.ID, warning)
+	}
 
 	// Create a response forwarder that will track the response
 	fw := &responseForwarder{
 		ResponseWriter: w,
 		callID:         call.ID,
 		tracker:        i.tracker,
+		captureHeaders: i.opts.CaptureHeaders,
+		idleTimeout:    i.opts.StreamIdleTimeout,
+		dropBodies:     i.opts.DropBodies,
+		redact:         i.opts.Redact,
+		traceChunks:    i.opts.TraceChunks,
+		maxBody:        i.opts.MaxBody,
+		lastChunk:      time.Now(),
+	}
+	if i.opts.CollapseStreams && wantsCollapse(r) {
+		fw.collapse = &streamCollapser{}
+	} else if i.opts.SynthStreams && !streamed {
+		fw.synth = synthStreamFor(r.URL.Path, bodyBytes)
+		fw.synthDelay = i.opts.SynthStreamDelay
 	}
 
 	// Set up context cancellation for client disconnection
 	fw.setupContext(r.Context())
+	i.tracker.SetCancel(call.ID, fw.cancel)
+
+	// Restore the request body for the proxy, bound to the forwarder's context
+	// so the upstream request is canceled together with the client
+	req := r.Clone(fw.ctx)
+	req.Body = io.NopCloser(body)
+	if !streamed {
+		// Lets the request be sent again, e.g. when retrying after 429
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(bodyBytes)), nil
+		}
+	}
+	if i.opts.CollapseStreams {
+		stripCollapse(req)
+	}
+	if call.TraceID != "" {
+		req.Header.Set("traceparent", tracing.Traceparent(call.TraceID, call.SpanID))
+	}
 
 	return fw, req, call.ID
 }
 
-// CompleteCall marks a call as completed and cleans up resources
+// RecordRateLimited tracks a request that was rejected by the rate limit without being forwarded
+func (i *Interceptor) RecordRateLimited(r *http.Request) {
+	// The body is not forwarded, so a large one is only read as far as it would be captured
+	bodyBytes, _, streamed, err := i.readBody(r)
+	if err != nil {
+		log.Printf("WARN: Reading the body of a rate limited request: %v", err)
+	}
+	model, stored, bytesIn := requestModel(bodyBytes), i.storedBody(bodyBytes), len(bodyBytes)
+	if streamed {
+		model, stored, bytesIn = headModel(bodyBytes), "", max(bytesIn, int(r.ContentLength))
+	}
+	ip := clientIP(r)
+	call := i.tracker.NewCall(r.Method, r.URL.Path, stored, func(c *types.Call) {
+		c.BytesIn = bytesIn
+		c.Model = model
+		c.ClientIP = ip
+		c.UserAgent = r.UserAgent()
+		c.ThreadID = c.ID
+	})
+	i.tracker.RateLimitCall(call.ID)
+}
+
+// readBody reads the request body. With StreamRequestsOver set, it stops after that many bytes and, for a
+// larger body, returns what was read so far and a reader continuing with the rest; streamed is true then.
+// The reader yields the whole body for forwarding either way.
+func (i *Interceptor) readBody(r *http.Request) (head []byte, body io.Reader, streamed bool, err error) {
+	limit := i.opts.StreamRequestsOver
+	if limit <= 0 {
+		head, err = io.ReadAll(r.Body)
+		return head, bytes.NewReader(head), false, err
+	}
+
+	head, err = io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if len(head) <= limit {
+		return head, bytes.NewReader(head), false, nil
+	}
+	return head, io.MultiReader(bytes.NewReader(head), r.Body), true, nil
+}
+
+// headModel extracts the model name from the start of a JSON request body that may be cut off,
+// which works as long as the model comes before the bulk of the body, e.g. images
+func headModel(head []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(head))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return ""
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if key == "model" {
+			var model string
+			dec.Decode(&model)
+			return model
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return ""
+		}
+	}
+	return ""
+}
+
+// estimatePromptTokens guesses the prompt size of a chat or generate request at about four characters
+// per token. Images are not counted.
+func estimatePromptTokens(body []byte) int {
+	var req struct {
+		Prompt   string            `json:"prompt"`
+		System   string            `json:"system"`
+		Suffix   string            `json:"suffix"`
+		Tools    json.RawMessage   `json:"tools"`
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0
+	}
+
+	chars := utf8.RuneCountInString(req.Prompt) + utf8.RuneCountInString(req.System) +
+		utf8.RuneCountInString(req.Suffix) + len(req.Tools)
+	for _, raw := range req.Messages {
+		var msg struct {
+			Content string `json:"content"`
+		}
+		json.Unmarshal(raw, &msg)
+		chars += utf8.RuneCountInString(msg.Content)
+	}
+	return (chars + 3) / 4
+}
+
+// storedBody returns the request body as it is kept on the call: redacted, or empty when bodies are dropped
+func (i *Interceptor) storedBody(body []byte) string {
+	if i.opts.DropBodies {
+		return ""
+	}
+	return redact(string(body), i.opts.Redact)
+}
+
+// redact replaces all matches of the patterns in s
+func redact(s string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		s = pattern.ReplaceAllLiteralString(s, RedactedText)
+	}
+	return s
+}
+
+// TruncateBody flattens a body onto one line and cuts it to at most limit bytes
+func TruncateBody(body string, limit int) string {
+	body = strings.ReplaceAll(strings.TrimSpace(body), "\n", " ")
+	if limit <= 0 || len(body) <= limit {
+		return body
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", body[:limit], len(body)-limit)
+}
+
+// requestModel extracts the model name from a JSON request body, if present
+func requestModel(body []byte) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return req.Model
+}
+
+// clientIP returns the address of the originating client, preferring the first
+// X-Forwarded-For entry when the request came through another proxy
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		if ip := strings.TrimSpace(first); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// CompleteCall forwards what is left of the response, marks the call as completed unless it
+// errored and cleans up resources
 func (i *Interceptor) CompleteCall(w http.ResponseWriter, callID string) {
 	if fw, ok := w.(*responseForwarder); ok {
+		fw.writeRemaining()
 		defer fw.Close()
 	}
+	if car, ok := AsCallAwareResponse(w); ok && car.Errored() {
+		return
+	}
 	i.tracker.CompleteCall(callID)
 }
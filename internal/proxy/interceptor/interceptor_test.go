@@ -0,0 +1,58 @@
+package interceptor
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ollama-proxy/internal/tracker"
+)
+
+func TestShouldIntercept(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		opts    Options
+		want    bool
+	}{
+		{name: "chat", path: "/api/chat", want: true},
+		{name: "generate", path: "/api/generate", want: true},
+		{name: "below a prefix", path: "/ollama/api/chat", want: true},
+		{name: "other path", path: "/api/embed", want: false},
+		{name: "websocket", path: "/api/chat", headers: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"}, want: false},
+		{name: "upgrade among connection options", path: "/api/chat", headers: map[string]string{"Connection": "keep-alive, upgrade"}, want: false},
+		{name: "upgrade header alone", path: "/api/generate", headers: map[string]string{"Upgrade": "h2c"}, want: false},
+		{name: "keep-alive", path: "/api/chat", headers: map[string]string{"Connection": "keep-alive"}, want: true},
+		{name: "passthrough", path: "/api/chat", opts: Options{Passthrough: true}, want: false},
+		{name: "configured paths", path: "/api/embed", opts: Options{InterceptPaths: []string{"/api/embed"}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewInterceptor(tracker.NewCallTracker(0, 0), tt.opts)
+			r := httptest.NewRequest("POST", tt.path, nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := i.ShouldIntercept(r); got != tt.want {
+				t.Errorf("ShouldIntercept() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordRateLimitedLargeBody(t *testing.T) {
+	tr := tracker.NewCallTracker(0, 10)
+	i := NewInterceptor(tr, Options{StreamRequestsOver: 32})
+	body := `{"model":"llava","prompt":"` + strings.Repeat("x", 100) + `"}`
+	i.RecordRateLimited(httptest.NewRequest("POST", "/api/generate", strings.NewReader(body)))
+
+	calls := tr.GetCalls()
+	if len(calls) != 1 {
+		t.Fatalf("%d calls tracked, want 1", len(calls))
+	}
+	call := calls[0].Snapshot()
+	if call.Model != "llava" || call.Request != "" || call.BytesIn != len(body) {
+		t.Errorf("model %q, request %q, %d bytes in; want the model of a body that is not captured", call.Model, call.Request, call.BytesIn)
+	}
+}
@@ -1,10 +1,17 @@
 package interceptor
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"ollama-proxy/internal/tracker"
 )
@@ -15,12 +22,37 @@ type responseForwarder struct {
 	callID  string
 	tracker *tracker.CallTracker
 
+	captureHeaders bool
+	idleTimeout    time.Duration
+	dropBodies     bool
+	redact         []*regexp.Regexp
+
 	mu      sync.Mutex
 	errored bool
 	buffer  []byte
 	ctx     context.Context
 	cancel  context.CancelFunc
 	done    chan struct{}
+
+	idleTimer *time.Timer
+
+	// passthrough forwards the response untouched, for content types the forwarder does not understand
+	passthrough bool
+
+	// collapse holds back a streamed response and sends it as one object at the end, nil unless the
+	// client asked for it
+	collapse *streamCollapser
+
+	// synth holds back a complete response to a request that asked for a stream and sends it in pieces
+	// at the end, synthDelay apart; nil unless enabled
+	synth      *streamSynthesizer
+	synthDelay time.Duration
+
+	// traceChunks logs every recorded object, its content cut to maxBody bytes
+	traceChunks bool
+	maxBody     int
+	chunks      int
+	lastChunk   time.Time
 }
 
 func (r *responseForwarder) CallID() string {
@@ -53,14 +85,59 @@ func (r *responseForwarder) Errored() bool {
 
 // WriteHeader captures the status code and marks errors for 4xx/5xx responses
 func (r *responseForwarder) WriteHeader(statusCode int) {
+	if r.tracker != nil {
+		r.tracker.SetStatusCode(r.callID, statusCode)
+	}
+	if r.captureHeaders && r.tracker != nil {
+		r.tracker.SetResponseHeaders(r.callID, redactHeaders(r.Header()))
+	}
+	r.mu.Lock()
+	r.resetIdleTimer()
+	r.mu.Unlock()
 	if statusCode >= 400 {
 		r.MarkError()
 	}
+	r.mu.Lock()
+	r.passthrough = !isJSONContentType(r.Header().Get("Content-Type"))
+	if r.collapse != nil && (statusCode != http.StatusOK || !isNDJSONContentType(r.Header().Get("Content-Type"))) {
+		r.collapse = nil
+	}
+	if r.collapse != nil {
+		r.Header().Del("Content-Length")
+		r.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	if r.synth != nil && (statusCode != http.StatusOK || !isSingleJSONContentType(r.Header().Get("Content-Type"))) {
+		r.synth = nil
+	}
+	if r.synth != nil {
+		r.Header().Del("Content-Length")
+		r.Header().Set("Content-Type", r.synth.contentType())
+	}
+	r.mu.Unlock()
 	r.ResponseWriter.WriteHeader(statusCode)
 }
 
+// isJSONContentType reports whether a response of the content type consists of JSON objects the
+// forwarder can split: JSON, NDJSON or server-sent events. A missing content type is assumed to be JSON.
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/ndjson", "text/event-stream":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json")
+}
+
 // setupContext sets up context cancellation when the client disconnects.
 // It ensures proper cleanup of resources and handles client disconnections.
+// The forwarder's own context is derived from the client context, so the
+// upstream request made with it is aborted as soon as the client goes away.
 func (r *responseForwarder) setupContext(ctx context.Context) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -72,7 +149,13 @@ func (r *responseForwarder) setupContext(ctx context.Context) {
 
 	r.done = make(chan struct{})
 	reqCtx, cancelReqCtx := context.WithCancel(ctx)
-	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.ctx, r.cancel = context.WithCancel(ctx)
+
+	// The idle watchdog runs from the moment the request is forwarded, so an
+	// upstream that stalls before sending headers is aborted too
+	if r.idleTimeout > 0 {
+		r.idleTimer = time.AfterFunc(r.idleTimeout, r.handleIdleTimeout)
+	}
 
 	// Start a goroutine to handle context cancellation
 	go func() {
@@ -127,66 +210,193 @@ func (r *responseForwarder) Close() {
 	if r.cancel != nil {
 		r.cancel()
 	}
+
+	if r.idleTimer != nil {
+		r.idleTimer.Stop()
+	}
 }
 
-// Flush flushes any buffered data to the client
-func (r *responseForwarder) Flush() {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// resetIdleTimer pushes the idle watchdog back whenever upstream makes progress,
+// so only a stalled response trips it. Callers must hold r.mu.
+func (r *responseForwarder) resetIdleTimer() {
+	if r.idleTimer != nil {
+		r.idleTimer.Reset(r.idleTimeout)
+	}
+}
 
-	// If we have any buffered data, write it to the client
-	if len(r.buffer) > 0 {
-		r.ResponseWriter.Write(r.buffer)
-		r.buffer = nil
+// handleIdleTimeout marks a stalled call as errored and aborts the upstream request,
+// which also closes the client connection
+func (r *responseForwarder) handleIdleTimeout() {
+	log.Printf("WARN: Call %s produced no output for %s, aborting", r.callID, r.idleTimeout)
+	r.MarkError()
+	if r.cancel != nil {
+		r.cancel()
 	}
+}
 
-	// Flush the underlying writer if it supports it
+// Flush sends the complete objects written so far to the client. An incomplete object stays
+// buffered until the rest of it arrives.
+func (r *responseForwarder) Flush() {
 	if f, ok := r.ResponseWriter.(http.Flusher); ok {
 		f.Flush()
 	}
 }
 
-// Write forwards complete JSON objects from the response data and updates the tracker
+// Write forwards the complete JSON objects in the response data and records each of them in the tracker.
+// A trailing incomplete object is held back until the rest of it arrives, data that is not JSON at all is
+// forwarded as-is. Responses of other content types are passed through without being recorded.
 func (r *responseForwarder) Write(data []byte) (int, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Combine buffer with new data
+	r.resetIdleTimer()
+	if r.tracker != nil {
+		r.tracker.AddBytesOut(r.callID, len(data))
+	}
+	if r.passthrough {
+		return r.ResponseWriter.Write(data)
+	}
+
 	combined := append(r.buffer, data...)
+	objects, rest := splitObjects(combined)
+	r.buffer = rest
 
-	// Try to parse the combined data as JSON
-	var obj json.RawMessage
-	err := json.Unmarshal(combined, &obj)
+	for _, object := range objects {
+		r.record(object)
+		r.holdBack(object)
+	}
+	if r.collapse != nil || r.synth != nil {
+		return len(data), nil
+	}
+	if complete := len(combined) - len(rest); complete > 0 {
+		if _, err := r.ResponseWriter.Write(combined[:complete]); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
 
+// holdBack keeps an object of a response that is sent reshaped at the end, and reports whether it did
+func (r *responseForwarder) holdBack(object []byte) bool {
 	switch {
-	// If it's valid JSON, write it and clear the buffer
-	case err == nil:
-		if r.tracker != nil && r.callID != "" {
-			r.tracker.UpdateCall(r.callID, string(combined))
+	case r.collapse != nil:
+		r.collapse.add(object)
+	case r.synth != nil:
+		r.synth.add(object)
+	default:
+		return false
+	}
+	return true
+}
+
+// writeRemaining forwards whatever is left in the buffer once the response has ended,
+// e.g. an object cut short by the upstream, and a collapsed or synthesized stream
+func (r *responseForwarder) writeRemaining() {
+	r.mu.Lock()
+	if len(r.buffer) > 0 {
+		r.record(r.buffer)
+		if !r.holdBack(r.buffer) {
+			r.ResponseWriter.Write(r.buffer)
 		}
-		r.buffer = nil // Clear the buffer
-		return r.ResponseWriter.Write(combined)
+		r.buffer = nil
+	}
+	if r.collapse != nil {
+		r.ResponseWriter.Write(r.collapse.result())
+		r.collapse = nil
+	}
 
-	// If we have a JSON syntax error, buffer the data for next time
-	case isJSONErrorRecoverable(err):
-		r.buffer = combined
-		return len(data), nil
+	// The upstream is done, so the idle watchdog must not trip while the frames are paced out
+	var frames [][]byte
+	if r.synth != nil {
+		frames = r.synth.frames()
+		r.synth = nil
+		if r.idleTimer != nil {
+			r.idleTimer.Stop()
+		}
+	}
+	r.mu.Unlock()
 
-	// For other errors, forward the data as-is
-	default:
-		r.buffer = nil // Clear the buffer on error
-		return r.ResponseWriter.Write(data)
+	r.writeFrames(frames)
+}
+
+// writeFrames sends the frames of a synthesized stream, synthDelay apart, until the client goes away
+func (r *responseForwarder) writeFrames(frames [][]byte) {
+	for i, frame := range frames {
+		if i > 0 && r.synthDelay > 0 {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(r.synthDelay):
+			}
+		}
+		if _, err := r.ResponseWriter.Write(frame); err != nil {
+			return
+		}
+		r.Flush()
 	}
 }
 
-// isJSONErrorRecoverable checks if a JSON parsing error might be due to incomplete data
-func isJSONErrorRecoverable(err error) bool {
-	switch err.Error() {
-	case "unexpected end of JSON input":
-		return true
-	case "unexpected EOF":
-		return true
-	default:
-		return false
+// record passes a response object to the tracker, keeping its redacted content unless bodies are dropped.
+// Each object is redacted on its own, as the stored response is the raw stream.
+func (r *responseForwarder) record(object []byte) {
+	if r.tracker == nil || r.callID == "" {
+		return
+	}
+	if r.traceChunks {
+		r.traceChunk(object)
+	}
+	if r.dropBodies {
+		r.tracker.CountCall(r.callID, string(object))
+	} else {
+		r.tracker.UpdateCall(r.callID, redact(string(object), r.redact))
 	}
 }
+
+// traceChunk logs the size of a response object, the time since the previous one (or since the
+// request for the first) and its redacted content
+func (r *responseForwarder) traceChunk(object []byte) {
+	now := time.Now()
+	gap := now.Sub(r.lastChunk)
+	r.lastChunk = now
+	r.chunks++
+
+	content := ""
+	if !r.dropBodies {
+		content = ": " + TruncateBody(redact(string(object), r.redact), r.maxBody)
+	}
+	log.Printf("DEBUG: Call %s chunk %d: %d bytes, +%s%s", r.callID, r.chunks, len(object), gap.Round(time.Millisecond), content)
+}
+
+// splitObjects splits data into complete JSON objects, each including the whitespace that follows it,
+// and an incomplete trailing object. If data is not JSON, it is returned as a single object.
+func splitObjects(data []byte) (objects [][]byte, rest []byte) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	start := 0
+	for {
+		var obj json.RawMessage
+		err := decoder.Decode(&obj)
+		switch {
+		case err == io.EOF:
+			// Nothing but whitespace left
+			if start < len(data) {
+				objects = append(objects, data[start:])
+			}
+			return objects, nil
+		case err == io.ErrUnexpectedEOF:
+			return objects, data[start:]
+		case err != nil:
+			return append(objects, data[start:]), nil
+		}
+
+		end := int(decoder.InputOffset())
+		for end < len(data) && isSpace(data[end]) {
+			end++
+		}
+		objects = append(objects, data[start:end])
+		start = end
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,244 @@
+package interceptor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
+)
+
+// newTestForwarder returns a forwarder of a new call writing to w, with the tracker events drained
+func newTestForwarder(t testing.TB, w http.ResponseWriter) (*responseForwarder, *types.Call) {
+	t.Helper()
+	tr := tracker.NewCallTracker(0, 0)
+	go func() {
+		for range tr.Events() {
+		}
+	}()
+	call := tr.NewCall("POST", "/api/chat", `{"model":"llama3"}`)
+	return &responseForwarder{ResponseWriter: w, callID: call.ID, tracker: tr}, call
+}
+
+// waitForEnd fails the test unless the call ends within a few seconds, and returns its final status
+func waitForEnd(t *testing.T, call *types.Call) types.CallStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for call.IsActive() {
+		if time.Now().After(deadline) {
+			t.Fatal("the call is still active")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return call.Status
+}
+
+func TestClientDisconnect(t *testing.T) {
+	fw, call := newTestForwarder(t, httptest.NewRecorder())
+	client, disconnect := context.WithCancel(context.Background())
+	fw.setupContext(client)
+	defer fw.Close()
+
+	fw.WriteHeader(http.StatusOK)
+	fw.Write([]byte(`{"message":{"role":"assistant","content":"Hel"},"done":false}` + "\n"))
+	disconnect()
+
+	if status := waitForEnd(t, call); status != types.StatusDisconnected {
+		t.Errorf("call status = %s, want %s", status, types.StatusDisconnected)
+	}
+	if !fw.Errored() {
+		t.Error("the forwarder of a disconnected call is not errored")
+	}
+	select {
+	case <-fw.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("the upstream context was not canceled")
+	}
+}
+
+func TestClientGoneAfterCompletion(t *testing.T) {
+	fw, call := newTestForwarder(t, httptest.NewRecorder())
+	client, disconnect := context.WithCancel(context.Background())
+	fw.setupContext(client)
+
+	fw.WriteHeader(http.StatusOK)
+	fw.Write([]byte(`{"message":{"role":"assistant","content":"Hi"},"done":true}` + "\n"))
+	fw.Close()
+	disconnect()
+
+	time.Sleep(20 * time.Millisecond)
+	if !call.IsActive() {
+		t.Errorf("call status = %s after the client left a finished response, want it left to the interceptor", call.Status)
+	}
+}
+
+func TestIdleTimeoutStalledStream(t *testing.T) {
+	fw, call := newTestForwarder(t, httptest.NewRecorder())
+	fw.idleTimeout = 50 * time.Millisecond
+	fw.setupContext(context.Background())
+	defer fw.Close()
+
+	fw.WriteHeader(http.StatusOK)
+	fw.Write([]byte(`{"response":"a","done":false}` + "\n"))
+	// The upstream stalls: nothing is written any more
+
+	if status := waitForEnd(t, call); status != types.StatusError {
+		t.Errorf("call status = %s, want %s", status, types.StatusError)
+	}
+	select {
+	case <-fw.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("the upstream request was not aborted")
+	}
+}
+
+func TestIdleTimeoutBeforeHeaders(t *testing.T) {
+	fw, call := newTestForwarder(t, httptest.NewRecorder())
+	fw.idleTimeout = 50 * time.Millisecond
+	fw.setupContext(context.Background())
+	defer fw.Close()
+	// The request was forwarded, but upstream never answers
+
+	if status := waitForEnd(t, call); status != types.StatusError {
+		t.Errorf("call status = %s, want %s", status, types.StatusError)
+	}
+	select {
+	case <-fw.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("the upstream request was not aborted")
+	}
+}
+
+func TestIdleTimeoutSlowStream(t *testing.T) {
+	fw, call := newTestForwarder(t, httptest.NewRecorder())
+	fw.idleTimeout = 100 * time.Millisecond
+	fw.setupContext(context.Background())
+	defer fw.Close()
+
+	// A generation that takes several timeouts in total but never pauses for one
+	fw.WriteHeader(http.StatusOK)
+	for range 10 {
+		fw.Write([]byte(`{"response":"a","done":false}` + "\n"))
+		time.Sleep(30 * time.Millisecond)
+	}
+	fw.Write([]byte(`{"response":"","done":true}` + "\n"))
+
+	if !call.IsActive() {
+		t.Errorf("call status = %s, the watchdog tripped on a progressing stream", call.Status)
+	}
+	if fw.ctx.Err() != nil {
+		t.Error("the upstream request of a progressing stream was aborted")
+	}
+}
+
+func TestIdleTimeoutDisabled(t *testing.T) {
+	fw, call := newTestForwarder(t, httptest.NewRecorder())
+	fw.setupContext(context.Background())
+	defer fw.Close()
+
+	fw.WriteHeader(http.StatusOK)
+	fw.Write([]byte(`{"response":"a","done":false}` + "\n"))
+	time.Sleep(50 * time.Millisecond)
+
+	if !call.IsActive() {
+		t.Errorf("call status = %s without an idle timeout", call.Status)
+	}
+}
+
+func TestUnknownContentTypeIsPassedThrough(t *testing.T) {
+	// Parts that would be held back or split if they were taken for JSON
+	parts := []string{`{"incomplete":`, "\x00\x01binary\n", `{"a":1}{"b":`, "2}"}
+
+	rec := httptest.NewRecorder()
+	fw, call := newTestForwarder(t, rec)
+	fw.Header().Set("Content-Type", "application/octet-stream")
+	fw.WriteHeader(http.StatusOK)
+	var want []byte
+	for _, part := range parts {
+		fw.Write([]byte(part))
+		if got := rec.Body.String(); got != string(want)+part {
+			t.Fatalf("after writing %q the client has %q, want it forwarded at once", part, got)
+		}
+		want = append(want, part...)
+	}
+	fw.writeRemaining()
+
+	if got := rec.Body.String(); got != string(want) {
+		t.Errorf("client received %q, want %q", got, want)
+	}
+	if call.Response != "" {
+		t.Errorf("recorded %q of a response that is not JSON", call.Response)
+	}
+}
+
+func TestIsJSONContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"", true},
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"application/x-ndjson", true},
+		{"application/ndjson", true},
+		{"text/event-stream", true},
+		{"application/problem+json", true},
+		{"application/grpc", false},
+		{"application/octet-stream", false},
+		{"text/plain; charset=utf-8", false},
+		{"not a media type;;", false},
+	}
+	for _, tt := range tests {
+		if got := isJSONContentType(tt.contentType); got != tt.want {
+			t.Errorf("isJSONContentType(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+// discardWriter is a response writer that throws the response away
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// BenchmarkResponseForwarder streams a 5000-chunk chat response through the forwarder, as written by the
+// reverse proxy: mostly one object per write, some split across writes
+func BenchmarkResponseForwarder(b *testing.B) {
+	const chunks = 5000
+	var writes [][]byte
+	for i := range chunks {
+		object := []byte(`{"model":"llama3","created_at":"2026-01-02T03:04:05Z","message":{"role":"assistant","content":" word"},"done":false}` + "\n")
+		if i == chunks-1 {
+			object = []byte(`{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":12,"eval_count":5000}` + "\n")
+		}
+		if i%10 == 0 {
+			writes = append(writes, object[:20], object[20:])
+		} else {
+			writes = append(writes, object)
+		}
+	}
+
+	tr := tracker.NewCallTracker(1, 0)
+	go func() {
+		for range tr.Events() {
+		}
+	}()
+	b.ReportAllocs()
+	for b.Loop() {
+		call := tr.NewCall("POST", "/api/chat", `{"model":"llama3"}`)
+		w := &discardWriter{header: http.Header{"Content-Type": {"application/x-ndjson"}}}
+		fw := &responseForwarder{ResponseWriter: w, callID: call.ID, tracker: tr}
+		fw.WriteHeader(http.StatusOK)
+		for _, data := range writes {
+			fw.Write(data)
+		}
+		fw.writeRemaining()
+		tr.CompleteCall(call.ID)
+	}
+}
@@ -0,0 +1,210 @@
+package interceptor
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"regexp"
+	"strings"
+)
+
+// streamSynthesizer turns the complete response of a backend that does not stream into the frames a
+// streaming client expects: NDJSON chunks for Ollama's API, server-sent events for the OpenAI one
+type streamSynthesizer struct {
+	sse  bool
+	body []byte
+}
+
+// synthStreamFor returns a synthesizer for a chat or generate request that asks for a streamed response,
+// or nil for any other request. Ollama streams unless told not to, the OpenAI API only when asked to.
+func synthStreamFor(path string, body []byte) *streamSynthesizer {
+	var req struct {
+		Stream *bool `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil
+	}
+	switch {
+	case strings.HasSuffix(path, "/v1/chat/completions"):
+		if req.Stream != nil && *req.Stream {
+			return &streamSynthesizer{sse: true}
+		}
+	case strings.HasSuffix(path, "/api/chat"), strings.HasSuffix(path, "/api/generate"):
+		if req.Stream == nil || *req.Stream {
+			return &streamSynthesizer{}
+		}
+	}
+	return nil
+}
+
+// isSingleJSONContentType reports whether a response of the content type is one complete JSON object
+func isSingleJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// contentType is the content type of the synthesized stream
+func (s *streamSynthesizer) contentType() string {
+	if s.sse {
+		return "text/event-stream"
+	}
+	return "application/x-ndjson"
+}
+
+// add takes in the next part of the response
+func (s *streamSynthesizer) add(object []byte) {
+	s.body = append(s.body, object...)
+}
+
+// frames splits the response into word-sized frames, ending with the final object and its stats.
+// A response it does not understand is sent as a single frame.
+func (s *streamSynthesizer) frames() [][]byte {
+	body := bytes.TrimSpace(s.body)
+	if s.sse {
+		return sseFrames(body)
+	}
+	return ndjsonFrames(body)
+}
+
+// ndjsonFrames streams a chat or generate response the way Ollama does: thinking first, then the content,
+// the tool calls in a chunk of their own, and the final object with an empty message or response
+func ndjsonFrames(body []byte) [][]byte {
+	var final map[string]json.RawMessage
+	var resp struct {
+		Response *string `json:"response"`
+		Thinking string  `json:"thinking"`
+		Message  *struct {
+			Role      string          `json:"role"`
+			Content   string          `json:"content"`
+			Thinking  string          `json:"thinking"`
+			ToolCalls json.RawMessage `json:"tool_calls"`
+		} `json:"message"`
+	}
+	if json.Unmarshal(body, &final) != nil || json.Unmarshal(body, &resp) != nil || (resp.Response == nil && resp.Message == nil) {
+		return [][]byte{append(body, '\n')}
+	}
+
+	var frames [][]byte
+	emit := func(fields map[string]any) {
+		for _, key := range []string{"model", "created_at"} {
+			if value, ok := final[key]; ok {
+				fields[key] = value
+			}
+		}
+		fields["done"] = false
+		data, _ := json.Marshal(fields)
+		frames = append(frames, append(data, '\n'))
+	}
+
+	if msg := resp.Message; msg != nil {
+		for _, piece := range splitWords(msg.Thinking) {
+			emit(map[string]any{"message": map[string]any{"role": msg.Role, "content": "", "thinking": piece}})
+		}
+		for _, piece := range splitWords(msg.Content) {
+			emit(map[string]any{"message": map[string]any{"role": msg.Role, "content": piece}})
+		}
+		if len(msg.ToolCalls) > 0 && string(msg.ToolCalls) != "null" {
+			emit(map[string]any{"message": map[string]any{"role": msg.Role, "content": "", "tool_calls": msg.ToolCalls}})
+		}
+		final["message"] = marshalRaw(map[string]string{"role": msg.Role, "content": ""})
+	} else {
+		for _, piece := range splitWords(resp.Thinking) {
+			emit(map[string]any{"response": "", "thinking": piece})
+		}
+		for _, piece := range splitWords(*resp.Response) {
+			emit(map[string]any{"response": piece})
+		}
+		final["response"] = marshalRaw("")
+		delete(final, "thinking")
+	}
+
+	data, _ := json.Marshal(final)
+	return append(frames, append(data, '\n'))
+}
+
+// sseDone ends a stream of the OpenAI API
+var sseDone = []byte("data: [DONE]\n\n")
+
+func sseFrame(data []byte) []byte {
+	return []byte("data: " + string(data) + "\n\n")
+}
+
+// sseFrames streams a chat completion as chat.completion.chunk events: the role with the first delta,
+// reasoning and content word by word, the tool calls at once, and the finish reason and usage last
+func sseFrames(body []byte) [][]byte {
+	var completion struct {
+		ID      string `json:"id"`
+		Created int64  `json:"created"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Index        int     `json:"index"`
+			FinishReason *string `json:"finish_reason"`
+			Message      struct {
+				Role      string           `json:"role"`
+				Content   string           `json:"content"`
+				Reasoning string           `json:"reasoning"`
+				ToolCalls []map[string]any `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage json.RawMessage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil || len(completion.Choices) != 1 {
+		return [][]byte{sseFrame(body), sseDone}
+	}
+	choice := completion.Choices[0]
+
+	var frames [][]byte
+	first := true
+	emit := func(delta map[string]any, finishReason *string, usage json.RawMessage) {
+		if first {
+			delta["role"] = choice.Message.Role
+			first = false
+		}
+		chunk := map[string]any{
+			"id":      completion.ID,
+			"object":  "chat.completion.chunk",
+			"created": completion.Created,
+			"model":   completion.Model,
+			"choices": []map[string]any{{"index": choice.Index, "delta": delta, "finish_reason": finishReason}},
+		}
+		if usage != nil {
+			chunk["usage"] = usage
+		}
+		data, _ := json.Marshal(chunk)
+		frames = append(frames, sseFrame(data))
+	}
+
+	for _, piece := range splitWords(choice.Message.Reasoning) {
+		emit(map[string]any{"reasoning": piece}, nil, nil)
+	}
+	for _, piece := range splitWords(choice.Message.Content) {
+		emit(map[string]any{"content": piece}, nil, nil)
+	}
+	if len(choice.Message.ToolCalls) > 0 {
+		for i, call := range choice.Message.ToolCalls {
+			call["index"] = i
+		}
+		emit(map[string]any{"tool_calls": choice.Message.ToolCalls}, nil, nil)
+	}
+	emit(map[string]any{}, choice.FinishReason, completion.Usage)
+	return append(frames, sseDone)
+}
+
+var wordPattern = regexp.MustCompile(`\s*\S+`)
+
+// splitWords cuts text into words, each with the whitespace before it, so that the pieces add up to the text
+func splitWords(text string) []string {
+	pieces := wordPattern.FindAllString(text, -1)
+	if len(pieces) == 0 {
+		if text == "" {
+			return nil
+		}
+		return []string{text}
+	}
+	n := 0
+	for _, piece := range pieces {
+		n += len(piece)
+	}
+	pieces[len(pieces)-1] += text[n:]
+	return pieces
+}
@@ -0,0 +1,77 @@
+package interceptor
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+)
+
+// maxThreadHistories bounds the number of message histories remembered to continue threads
+const maxThreadHistories = 10000
+
+// threadIndex assigns chat calls to conversation threads. Chat clients resend the whole history with
+// every turn, so a call continues the thread of an earlier call from the same client and for the same
+// model whose messages it starts with. Only hashes of the histories are kept.
+type threadIndex struct {
+	mu      sync.Mutex
+	threads map[uint64]string
+	order   []uint64
+}
+
+func newThreadIndex() *threadIndex {
+	return &threadIndex{threads: make(map[uint64]string)}
+}
+
+// historyHashes hashes the message history of a chat request for assign: element k is the hash of the
+// first k+1 messages. It is nil for requests that are not chat requests.
+func historyHashes(clientIP, model string, body []byte) []uint64 {
+	var req struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.Messages) == 0 {
+		return nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(clientIP + "\x00" + model + "\x00"))
+	prefixes := make([]uint64, len(req.Messages))
+	for k, msg := range req.Messages {
+		h.Write([]byte(msg.Role + "\x00" + msg.Content + "\x00"))
+		prefixes[k] = h.Sum64()
+	}
+	return prefixes
+}
+
+// assign returns the thread of a call from its historyHashes: the thread of the longest earlier history
+// the request continues, or a new thread named after the call. Calls that are not chat requests always
+// get their own thread.
+func (x *threadIndex) assign(callID string, prefixes []uint64) string {
+	if len(prefixes) == 0 {
+		return callID
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	thread := callID
+	for k := len(prefixes) - 1; k >= 0; k-- {
+		if id, ok := x.threads[prefixes[k]]; ok {
+			thread = id
+			break
+		}
+	}
+
+	full := prefixes[len(prefixes)-1]
+	if _, ok := x.threads[full]; !ok {
+		x.order = append(x.order, full)
+		if len(x.order) > maxThreadHistories {
+			delete(x.threads, x.order[0])
+			x.order = x.order[1:]
+		}
+	}
+	x.threads[full] = thread
+	return thread
+}
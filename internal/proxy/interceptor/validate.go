@@ -0,0 +1,92 @@
+package interceptor
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// requestFields are the top-level fields Ollama accepts for each endpoint
+var requestFields = map[string][]string{
+	"/api/generate": {"model", "prompt", "suffix", "images", "format", "options", "system", "template", "stream", "raw", "keep_alive", "context", "think"},
+	"/api/chat":     {"model", "messages", "tools", "format", "options", "stream", "keep_alive", "think"},
+}
+
+// messageFields are the fields of a chat message
+var messageFields = []string{"role", "content", "images", "tool_calls", "tool_name", "thinking"}
+
+var messageRoles = []string{"system", "user", "assistant", "tool"}
+
+// modelOptions are the common model parameters that belong in "options" rather than at the top level
+var modelOptions = []string{
+	"temperature", "top_k", "top_p", "min_p", "num_ctx", "num_predict", "seed", "stop",
+	"repeat_penalty", "repeat_last_n", "presence_penalty", "frequency_penalty", "mirostat", "num_gpu", "num_thread",
+}
+
+// validateRequest checks a chat or generate request body for mistakes Ollama would reject or silently ignore.
+// It returns a warning per problem found, or nil for other endpoints.
+func validateRequest(endpoint string, body []byte) []string {
+	var fields []string
+	for suffix, known := range requestFields {
+		if strings.HasSuffix(endpoint, suffix) {
+			fields = known
+		}
+	}
+	if fields == nil {
+		return nil
+	}
+
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		return []string{"body is not a JSON object"}
+	}
+
+	var warnings []string
+	if _, ok := req["model"]; !ok {
+		warnings = append(warnings, `missing required field "model"`)
+	}
+	for _, key := range slices.Sorted(maps.Keys(req)) {
+		switch {
+		case slices.Contains(fields, key):
+		case slices.Contains(modelOptions, key):
+			warnings = append(warnings, fmt.Sprintf("%q is ignored at the top level, it belongs in \"options\"", key))
+		default:
+			warnings = append(warnings, fmt.Sprintf("unknown field %q", key))
+		}
+	}
+
+	if slices.Contains(fields, "messages") {
+		if raw, ok := req["messages"]; ok {
+			warnings = append(warnings, validateMessages(raw)...)
+		} else {
+			warnings = append(warnings, `missing required field "messages"`)
+		}
+	}
+	return warnings
+}
+
+// validateMessages checks the roles and fields of chat messages
+func validateMessages(raw json.RawMessage) []string {
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &messages); err != nil {
+		return []string{`"messages" is not a list of objects`}
+	}
+
+	var warnings []string
+	for i, msg := range messages {
+		var role string
+		if err := json.Unmarshal(msg["role"], &role); err != nil || role == "" {
+			warnings = append(warnings, fmt.Sprintf("message %d has no role", i))
+		} else if !slices.Contains(messageRoles, role) {
+			warnings = append(warnings, fmt.Sprintf("message %d has unknown role %q", i, role))
+		}
+		for _, key := range slices.Sorted(maps.Keys(msg)) {
+			if !slices.Contains(messageFields, key) {
+				warnings = append(warnings, fmt.Sprintf("message %d has unknown field %q", i, key))
+			}
+		}
+	}
+	return warnings
+}
@@ -1,33 +1,230 @@
 package proxy
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"ollama-proxy/internal/proxy/interceptor"
 	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
 )
 
+// Options configures optional proxy behavior
+type Options struct {
+	// TargetPathPrefix is appended to the path of the target, for an upstream served under a subpath
+	TargetPathPrefix string
+
+	// UpstreamHost is sent as the Host header to the target instead of the one the client used,
+	// for upstreams behind a name-based router. Routed requests are not affected.
+	UpstreamHost string
+
+	// Routes maps model names to upstream URLs. Requests for models without a
+	// route are forwarded to the default target.
+	Routes map[string]string
+
+	// CaptureHeaders stores the request and response headers of intercepted calls
+	CaptureHeaders bool
+
+	// StreamIdleTimeout aborts calls whose response stalls for longer than this; zero disables it
+	StreamIdleTimeout time.Duration
+
+	// InterceptPaths lists the endpoint suffixes whose calls are tracked; empty means the
+	// chat and generate endpoints
+	InterceptPaths []string
+
+	// Passthrough forwards every request untouched, without interception or tracking
+	Passthrough bool
+
+	// DropBodies tracks calls without keeping their request and response bodies
+	DropBodies bool
+
+	// Redact lists patterns replaced in the stored request and response bodies
+	Redact []*regexp.Regexp
+
+	// ValidateRequests warns about unknown or missing fields in chat and generate requests
+	ValidateRequests bool
+
+	// Tracing assigns every intercepted call a trace span and propagates it upstream
+	Tracing bool
+
+	// Management is served under ManagementPrefix instead of being proxied, if set
+	Management http.Handler
+
+	// Retry429 retries requests the upstream answers with 429 Too Many Requests up to this many times,
+	// waiting as long as its Retry-After header asks but at most Retry429MaxWait; zero disables retries
+	Retry429        int
+	Retry429MaxWait time.Duration
+
+	// RateLimits maps endpoint suffixes to the requests per second allowed; requests over the
+	// limit are answered with 429
+	RateLimits map[string]float64
+
+	// SingleFlight forwards only the first of several identical concurrent requests upstream,
+	// the others receive a copy of its response
+	SingleFlight bool
+
+	// Verbose logs the request and final response of every intercepted call at debug level
+	Verbose bool
+
+	// MaxBody caps the number of bytes of each body written to the log; zero means no limit
+	MaxBody int
+
+	// TraceChunks logs every response object of intercepted calls with its size and timing
+	TraceChunks bool
+
+	// StreamRequestsOver forwards larger request bodies while they are read, without capturing them;
+	// zero buffers every request
+	StreamRequestsOver int
+
+	// CollapseStreams sends a streamed chat or generate response as one object to clients that ask for it
+	CollapseStreams bool
+
+	// SynthStreams sends a complete response to a request that asked for a stream in pieces,
+	// SynthStreamDelay apart, for backends that do not stream
+	SynthStreams     bool
+	SynthStreamDelay time.Duration
+
+	// MaxIdleConns caps the idle connections kept open to each upstream; zero keeps Go's default of two
+	MaxIdleConns int
+
+	// MaxConnsPerHost caps the connections to each upstream, further requests wait for a free one; zero means no limit
+	MaxConnsPerHost int
+
+	// IdleConnTimeout closes idle upstream connections after this long; zero keeps them open
+	IdleConnTimeout time.Duration
+
+	// HTTP2 negotiates HTTP/2 with upstreams served over TLS instead of staying on HTTP/1.1
+	HTTP2 bool
+
+	// ForwardedHeaders sets X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto on
+	// upstream requests. When disabled, none of them are sent.
+	ForwardedHeaders bool
+
+	// RequestHooks run in order on every upstream request, after the forwarded headers were set
+	RequestHooks []RequestHook
+
+	// ResponseHooks run in order on every upstream response before it is passed on
+	ResponseHooks []ResponseHook
+}
+
 // Proxy represents an HTTP reverse proxy that can intercept and track specific requests
 type Proxy struct {
 	target      *url.URL
+	routes      map[string]*url.URL
+	routesMu    sync.RWMutex
 	proxy       *httputil.ReverseProxy
 	interceptor *interceptor.Interceptor
+	tracker     *tracker.CallTracker
+	verbose     bool
+	maxBody     int
+	forwarded   bool
+	flights     *flightGroup // nil unless single-flight is enabled
+	limiter     *rateLimiter // nil unless rate limits are configured
+	management  http.Handler
+
+	transport     *http.Transport
+	responseHooks []ResponseHook
+
+	// upstreamHost overrides the Host header of requests to the default target
+	upstreamHost string
 }
 
+// ManagementPrefix is the path under which the management endpoints are served on the proxy listener.
+// Requests below it never reach the upstream.
+const ManagementPrefix = "/__proxy/"
+
+type targetKey struct{}
+
+type callKey struct{}
+
 // NewProxy creates a new Proxy instance
-func NewProxy(target string, tracker *tracker.CallTracker) (*Proxy, error) {
+func NewProxy(target string, tracker *tracker.CallTracker, opts Options) (*Proxy, error) {
 	targetURL, err := url.Parse(target)
 	if err != nil {
 		return nil, err
 	}
+	if opts.TargetPathPrefix != "" {
+		targetURL.Path = path.Join("/", targetURL.Path, opts.TargetPathPrefix)
+		targetURL.RawPath = ""
+	}
+
+	routes, err := parseRoutes(opts.Routes)
+	if err != nil {
+		return nil, err
+	}
+
+	interceptorOpts := interceptor.Options{
+		CaptureHeaders:     opts.CaptureHeaders,
+		StreamIdleTimeout:  opts.StreamIdleTimeout,
+		InterceptPaths:     opts.InterceptPaths,
+		Tracing:            opts.Tracing,
+		Passthrough:        opts.Passthrough,
+		ValidateRequests:   opts.ValidateRequests,
+		DropBodies:         opts.DropBodies,
+		Redact:             opts.Redact,
+		TraceChunks:        opts.TraceChunks,
+		MaxBody:            opts.MaxBody,
+		StreamRequestsOver: opts.StreamRequestsOver,
+		CollapseStreams:    opts.CollapseStreams,
+		SynthStreams:       opts.SynthStreams,
+		SynthStreamDelay:   opts.SynthStreamDelay,
+	}
 
 	p := &Proxy{
 		target:      targetURL,
-		interceptor: interceptor.NewInterceptor(tracker),
+		routes:      routes,
+		interceptor: interceptor.NewInterceptor(tracker, interceptorOpts),
+		tracker:     tracker,
+		verbose:     opts.Verbose,
+		maxBody:     opts.MaxBody,
+		forwarded:   opts.ForwardedHeaders,
+
+		responseHooks: opts.ResponseHooks,
+		upstreamHost:  opts.UpstreamHost,
+	}
+	if opts.Management != nil {
+		p.management = http.StripPrefix(strings.TrimSuffix(ManagementPrefix, "/"), opts.Management)
+	}
+	if len(opts.RateLimits) > 0 {
+		p.limiter = newRateLimiter(opts.RateLimits)
+	}
+	if opts.SingleFlight {
+		p.flights = &flightGroup{flights: make(map[string]*flight)}
+	}
+
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		MaxConnsPerHost:   opts.MaxConnsPerHost,
+		IdleConnTimeout:   opts.IdleConnTimeout,
+		ForceAttemptHTTP2: opts.HTTP2,
+	}
+	// The total stays unlimited, so that routed upstreams do not compete for idle connections
+	if opts.MaxIdleConns > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConns
+	}
+
+	p.transport = transport
+
+	var base http.RoundTripper = transport
+	if opts.Retry429 > 0 {
+		base = &retryTransport{
+			base:     transport,
+			attempts: opts.Retry429,
+			maxWait:  opts.Retry429MaxWait,
+			onRetry:  p.retrying,
+		}
 	}
 
 	// Initialize the reverse proxy
@@ -35,8 +232,9 @@ func NewProxy(target string, tracker *tracker.CallTracker) (*Proxy, error) {
 		Director:       p.director,
 		ModifyResponse: p.modifyResponse,
 		ErrorHandler:   p.errorHandler,
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
+		Transport: &hookTransport{
+			base:  base,
+			hooks: append([]RequestHook{p.setForwardedHeaders, p.setUpstreamHost}, opts.RequestHooks...),
 		},
 	}
 
@@ -45,6 +243,20 @@ func NewProxy(target string, tracker *tracker.CallTracker) (*Proxy, error) {
 
 // ServeHTTP handles incoming HTTP requests
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.management != nil && strings.HasPrefix(r.URL.Path, ManagementPrefix) {
+		p.management.ServeHTTP(w, r)
+		return
+	}
+
+	r = p.stripTargetPath(r)
+
+	if p.limiter != nil {
+		if ok, retryAfter := p.limiter.allow(r.URL.Path); !ok {
+			p.rejectRateLimited(w, r, retryAfter)
+			return
+		}
+	}
+
 	if p.interceptor.ShouldIntercept(r) {
 		fw, req, callID := p.interceptor.InterceptRequest(w, r)
 		if fw == nil || req == nil || callID == "" {
@@ -52,13 +264,30 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		p.proxy.ServeHTTP(fw, req)
+		// Route on the model captured by the interceptor, as the body has already been consumed
+		var key string
+		if call, ok := p.tracker.GetCall(callID); ok {
+			target := p.targetFor(call.Model)
+			p.tracker.SetUpstream(callID, target.String())
+			ctx := context.WithValue(req.Context(), targetKey{}, target)
+			req = req.WithContext(context.WithValue(ctx, callKey{}, callID))
+			// Streamed requests were not captured, so identical ones cannot be recognized
+			if p.flights != nil && !call.RequestStreamed {
+				key = flightKey(call, target.String(), req.Header)
+			}
+		}
 
-		if car, ok := interceptor.AsCallAwareResponse(fw); ok && car.Errored() {
-			return
+		if key != "" {
+			p.serveSingleFlight(fw, req, callID, key)
+		} else {
+			p.proxy.ServeHTTP(fw, req)
 		}
 
 		p.interceptor.CompleteCall(fw, callID)
+
+		if p.verbose {
+			p.logBodies(callID)
+		}
 		return
 	}
 
@@ -66,12 +295,159 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	p.proxy.ServeHTTP(w, r)
 }
 
+// rejectRateLimited answers a request over its rate limit with 429. Requests that would have been
+// intercepted are tracked as rate limited calls.
+func (p *Proxy) rejectRateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	log.Printf("WARN: Rate limit exceeded for %s %s", r.Method, r.URL.Path)
+	if p.interceptor.ShouldIntercept(r) {
+		p.interceptor.RecordRateLimited(r)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+	interceptor.WriteError(w, r, http.StatusTooManyRequests, "rate limit exceeded", "")
+}
+
+// logBodies writes the request and response of a call to the log
+func (p *Proxy) logBodies(callID string) {
+	call, ok := p.tracker.GetCall(callID)
+	if !ok {
+		return
+	}
+	request, response := call.Bodies()
+	log.Printf("DEBUG: Call %s request: %s", callID, interceptor.TruncateBody(request, p.maxBody))
+	log.Printf("DEBUG: Call %s response: %s", callID, interceptor.TruncateBody(response, p.maxBody))
+}
+
+// Replay re-issues a captured call through the proxy in the background.
+// The replay is tracked as a new call linked to the original one.
+func (p *Proxy) Replay(call *types.Call) error {
+	if call.RequestStreamed {
+		return errors.New("the request body was streamed without being captured")
+	}
+	ctx := interceptor.WithReplayOf(context.Background(), call.ID)
+	request, _ := call.Bodies()
+	req, err := http.NewRequestWithContext(ctx, call.Method, call.Endpoint, strings.NewReader(request))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	go p.ServeHTTP(&discardResponseWriter{header: make(http.Header)}, req)
+	return nil
+}
+
+// discardResponseWriter is the client side of a replayed request; the response is only tracked
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header         { return d.header }
+func (d *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardResponseWriter) WriteHeader(int)             {}
+
+// CheckUpstream asks the default upstream for its version to find out whether it is reachable
+func (p *Proxy) CheckUpstream(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.target.JoinPath("/api/version").String(), nil)
+	if err != nil {
+		return err
+	}
+	if p.upstreamHost != "" {
+		req.Host = p.upstreamHost
+	}
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// parseRoutes parses the upstream URL of every route
+func parseRoutes(rules map[string]string) (map[string]*url.URL, error) {
+	routes := make(map[string]*url.URL, len(rules))
+	for model, upstream := range rules {
+		routeURL, err := url.Parse(upstream)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route for model %q: %w", model, err)
+		}
+		routes[model] = routeURL
+	}
+	return routes, nil
+}
+
+// SetRoutes replaces the model routes. Calls already in flight keep their upstream.
+func (p *Proxy) SetRoutes(rules map[string]string) error {
+	routes, err := parseRoutes(rules)
+	if err != nil {
+		return err
+	}
+	p.routesMu.Lock()
+	p.routes = routes
+	p.routesMu.Unlock()
+	return nil
+}
+
+// SetInterceptPaths replaces the endpoint suffixes whose calls are tracked
+func (p *Proxy) SetInterceptPaths(paths []string) {
+	p.interceptor.SetPaths(paths)
+}
+
+// stripTargetPath removes the path of the default target from requests that include it, so that
+// clients may use either the proxy root or the upstream's subpath, e.g. both /api/chat and
+// /ollama/api/chat for a target of https://host/ollama. The director adds it back when forwarding.
+func (p *Proxy) stripTargetPath(r *http.Request) *http.Request {
+	prefix := strings.TrimSuffix(p.target.Path, "/")
+	if prefix == "" {
+		return r
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return r
+	}
+
+	stripped := new(http.Request)
+	*stripped = *r
+	stripped.URL = new(url.URL)
+	*stripped.URL = *r.URL
+	stripped.URL.Path = "/" + strings.TrimPrefix(rest, "/")
+	stripped.URL.RawPath = ""
+	return stripped
+}
+
+// targetFor returns the upstream for the given model, falling back to the default target.
+// Models are matched by full name first and then without their tag (e.g. "llama3:8b" -> "llama3").
+func (p *Proxy) targetFor(model string) *url.URL {
+	p.routesMu.RLock()
+	defer p.routesMu.RUnlock()
+	if model != "" {
+		if target, ok := p.routes[model]; ok {
+			return target
+		}
+		if name, _, found := strings.Cut(model, ":"); found {
+			if target, ok := p.routes[name]; ok {
+				return target
+			}
+		}
+	}
+	return p.target
+}
+
 // director modifies the request to be sent to the target
 func (p *Proxy) director(req *http.Request) {
-	targetQuery := p.target.RawQuery
-	req.URL.Scheme = p.target.Scheme
-	req.URL.Host = p.target.Host
-	req.URL.Path = path.Join(p.target.Path, req.URL.Path)
+	target, ok := req.Context().Value(targetKey{}).(*url.URL)
+	if !ok {
+		target = p.target
+	}
+
+	targetQuery := target.RawQuery
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path = path.Join(target.Path, req.URL.Path)
 
 	switch {
 	case targetQuery == "" || req.URL.RawQuery == "":
@@ -85,19 +461,71 @@ func (p *Proxy) director(req *http.Request) {
 	}
 }
 
-// modifyResponse can be used to modify the response before it's sent to the client
+// setForwardedHeaders is the built-in request hook adding the standard reverse proxy headers,
+// keeping the values of earlier proxies in the chain. X-Forwarded-For itself has already been
+// appended to by httputil.ReverseProxy.
+func (p *Proxy) setForwardedHeaders(req *http.Request) error {
+	if !p.forwarded {
+		req.Header.Del("X-Forwarded-For")
+		req.Header.Del("X-Forwarded-Host")
+		req.Header.Del("X-Forwarded-Proto")
+		return nil
+	}
+
+	if req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+	if req.Header.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if req.TLS != nil {
+			proto = "https"
+		}
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+	return nil
+}
+
+// setUpstreamHost is the built-in request hook replacing the Host header of requests to the default
+// target. It runs after setForwardedHeaders so X-Forwarded-Host keeps the host the client asked for.
+func (p *Proxy) setUpstreamHost(req *http.Request) error {
+	if p.upstreamHost == "" {
+		return nil
+	}
+	if target, ok := req.Context().Value(targetKey{}).(*url.URL); ok && target != p.target {
+		return nil
+	}
+	req.Host = p.upstreamHost
+	return nil
+}
+
+// retrying records that the upstream answered a call with 429 and the request is sent again after wait
+func (p *Proxy) retrying(req *http.Request, retry int, wait time.Duration) {
+	callID, _ := req.Context().Value(callKey{}).(string)
+	if callID == "" {
+		log.Printf("WARN: Upstream answered %s with 429, retry %d in %s", req.URL.Path, retry, wait)
+		return
+	}
+	log.Printf("WARN: Upstream answered call %s with 429, retry %d in %s", callID, retry, wait)
+	p.tracker.RetryCall(callID)
+}
+
+// modifyResponse runs the response hooks before the response is sent to the client
 func (p *Proxy) modifyResponse(resp *http.Response) error {
-	// Response modification logic would go here
+	for _, hook := range p.responseHooks {
+		if err := hook(resp); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // errorHandler handles proxy errors
 func (p *Proxy) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
-	log.Printf("http: proxy error: %v", err)
+	log.Printf("ERROR: http: proxy error: %v", err)
 
 	if car, ok := interceptor.AsCallAwareResponse(w); ok {
 		car.MarkError()
 	}
 
-	w.WriteHeader(http.StatusBadGateway)
+	interceptor.WriteError(w, r, http.StatusBadGateway, "upstream unavailable", err.Error())
 }
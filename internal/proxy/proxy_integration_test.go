@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"ollama-proxy/internal/types"
+)
+
+// upstreamResponse is what the fake Ollama answers on one path, written in the given parts with a flush after each
+type upstreamResponse struct {
+	status      int
+	contentType string
+	parts       []string
+}
+
+func (u upstreamResponse) body() string {
+	return strings.Join(u.parts, "")
+}
+
+// newFakeOllama serves the responses by path. The returned function gives the last request body received on a path.
+func newFakeOllama(t *testing.T, responses map[string]upstreamResponse) (*httptest.Server, func(path string) string) {
+	t.Helper()
+	var mu sync.Mutex
+	received := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = string(body)
+		mu.Unlock()
+
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", resp.contentType)
+		w.WriteHeader(resp.status)
+		for _, part := range resp.parts {
+			io.WriteString(w, part)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func(path string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		return received[path]
+	}
+}
+
+func TestPassthroughIsByteForByte(t *testing.T) {
+	const chatRequest = `{"model":"llama3","messages":[{"role":"user","content":"Hi"}]}`
+	const generateRequest = `{"model":"llama3","prompt":"Hi","stream":false}`
+
+	tests := []struct {
+		name     string
+		path     string
+		request  string
+		response upstreamResponse
+		status   types.CallStatus
+		error    string
+
+		unrecorded bool
+	}{
+		{
+			name:    "single object",
+			path:    "/api/generate",
+			request: generateRequest,
+			response: upstreamResponse{http.StatusOK, "application/json; charset=utf-8", []string{
+				`{"model":"llama3","created_at":"2026-01-02T03:04:05Z","response":"Hello!","done":true,"eval_count":2}`,
+			}},
+			status: types.StatusDone,
+		},
+		{
+			name:    "streamed",
+			path:    "/api/chat",
+			request: chatRequest,
+			response: upstreamResponse{http.StatusOK, "application/x-ndjson", []string{
+				// Several objects in one write, objects split across writes, and unicode split inside a character
+				`{"model":"llama3","message":{"role":"assistant","content":"Hel"},"done":false}` + "\n" +
+					`{"model":"llama3","message":{"role":"assistant","content":"lo"},"done":false}` + "\n",
+				`{"model":"llama3","message":{"role":"assistant","content":" wor`,
+				`ld \xe2\x9c`,
+				"\x93\"},\"done\":false}\n",
+				`{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":4}` + "\n",
+			}},
+			status: types.StatusDone,
+		},
+		{
+			name:    "streamed without trailing newline",
+			path:    "/api/generate",
+			request: `{"model":"llama3","prompt":"Hi"}`,
+			response: upstreamResponse{http.StatusOK, "application/x-ndjson", []string{
+				`{"response":"a","done":false}` + "\n",
+				`{"response":"","done":true}`,
+			}},
+			status: types.StatusDone,
+		},
+		{
+			name:    "error",
+			path:    "/api/chat",
+			request: chatRequest,
+			response: upstreamResponse{http.StatusNotFound, "application/json; charset=utf-8", []string{
+				`{"error":"model \"llama3\" not found, try pulling it first"}`,
+			}},
+			status: types.StatusError,
+			error:  `model "llama3" not found, try pulling it first`,
+		},
+		{
+			name:    "error in stream",
+			path:    "/api/chat",
+			request: chatRequest,
+			response: upstreamResponse{http.StatusOK, "application/x-ndjson", []string{
+				`{"model":"llama3","message":{"role":"assistant","content":"Hi"},"done":false}` + "\n",
+				`{"error":"an error was encountered while running the model"}` + "\n",
+			}},
+			// The stream itself succeeded, the error is recorded on the call
+			status: types.StatusDone,
+			error:  "an error was encountered while running the model",
+		},
+		{
+			name:    "unexpected content type",
+			path:    "/api/generate",
+			request: generateRequest,
+			response: upstreamResponse{http.StatusOK, "application/octet-stream", []string{
+				`{"looks":"like`, "\x00\x01\xff", `" JSON"}` + "\n", `{"but":`,
+			}},
+			status: types.StatusDone,
+			// Only JSON is recorded
+			unrecorded: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, received := newFakeOllama(t, map[string]upstreamResponse{tt.path: tt.response})
+			server, tr := newTestProxy(t, upstream.URL, Options{})
+
+			resp, err := http.Post(server.URL+tt.path, "application/json", strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := received(tt.path); got != tt.request {
+				t.Errorf("upstream received %q, want %q", got, tt.request)
+			}
+			if resp.StatusCode != tt.response.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.response.status)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.response.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.response.contentType)
+			}
+			if want := tt.response.body(); !bytes.Equal(body, []byte(want)) {
+				t.Errorf("client received\n%q\nupstream sent\n%q", body, want)
+			}
+
+			calls := tr.GetCalls()
+			if len(calls) != 1 {
+				t.Fatalf("%d calls tracked, want 1", len(calls))
+			}
+			call := calls[0]
+			if call.IsActive() {
+				t.Fatal("the call is still active after the response ended")
+			}
+			if call.Status != tt.status {
+				t.Errorf("call status = %s, want %s", call.Status, tt.status)
+			}
+			if call.Error != tt.error {
+				t.Errorf("call error = %q, want %q", call.Error, tt.error)
+			}
+			if want := tt.response.body(); call.Response != want && !tt.unrecorded {
+				t.Errorf("recorded response\n%q\nupstream sent\n%q", call.Response, want)
+			}
+		})
+	}
+}
+
+func TestPassthroughOfOtherPaths(t *testing.T) {
+	response := upstreamResponse{http.StatusOK, "text/plain; charset=utf-8", []string{"Ollama is running"}}
+	upstream, _ := newFakeOllama(t, map[string]upstreamResponse{"/": response})
+	server, tr := newTestProxy(t, upstream.URL, Options{})
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != response.body() {
+		t.Errorf("client received %q, upstream sent %q", body, response.body())
+	}
+	if calls := tr.GetCalls(); len(calls) != 0 {
+		t.Errorf("%d calls tracked for a path that is not intercepted", len(calls))
+	}
+}
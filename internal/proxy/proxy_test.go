@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
+)
+
+// newTestProxy serves a proxy to target with a tracker whose events are drained, as the TUI would
+func newTestProxy(t *testing.T, target string, opts Options) (*httptest.Server, *tracker.CallTracker) {
+	t.Helper()
+	tr := tracker.NewCallTracker(0, 0)
+	go func() {
+		for range tr.Events() {
+		}
+	}()
+	p, err := NewProxy(target, tr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(p)
+	t.Cleanup(server.Close)
+	return server, tr
+}
+
+func TestClientDisconnectCancelsUpstream(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, `{"response":"a","done":false}`+"\n")
+		w.(http.Flusher).Flush()
+		close(started)
+
+		// Generate until the proxy gives up on the request
+		select {
+		case <-r.Context().Done():
+			close(canceled)
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	server, tr := newTestProxy(t, upstream.URL, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/api/generate", strings.NewReader(`{"model":"llama3","prompt":"Hi"}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != `{"response":"a","done":false}`+"\n" {
+		t.Fatalf("first chunk = %q, %v", line, err)
+	}
+	<-started
+
+	// Canceling the request closes the client connection mid-stream
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the upstream request was not canceled after the client went away")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		calls := tr.GetCalls()
+		if len(calls) == 1 && !calls[0].IsActive() {
+			if calls[0].Status != types.StatusDisconnected {
+				t.Errorf("call status = %s, want %s", calls[0].Status, types.StatusDisconnected)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the call was not finished after the client went away: %d calls", len(calls))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUpgradeBypassesInterception(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "upgrade expected", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		rw.Flush()
+		// Echo a line of the raw protocol
+		line, _ := rw.ReadString('\n')
+		rw.WriteString(line)
+		rw.Flush()
+	}))
+	t.Cleanup(upstream.Close)
+	server, tr := newTestProxy(t, upstream.URL, Options{})
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /api/chat HTTP/1.1\r\nHost: ollama\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	const frame = "\x81\x04{\"a\"}\n"
+	io.WriteString(conn, frame)
+	if echoed, err := reader.ReadString('\n'); err != nil || echoed != frame {
+		t.Errorf("echoed %q, %v, want %q", echoed, err, frame)
+	}
+	if calls := tr.GetCalls(); len(calls) != 0 {
+		t.Errorf("%d calls tracked for an upgraded connection", len(calls))
+	}
+}
+
+func TestTargetPaths(t *testing.T) {
+	tests := []struct {
+		name         string
+		targetPath   string
+		prefix       string
+		requestPath  string
+		upstreamPath string
+		endpoint     string
+	}{
+		{name: "no path", requestPath: "/api/chat", upstreamPath: "/api/chat", endpoint: "/api/chat"},
+		{name: "trailing slash only", targetPath: "/", requestPath: "/api/chat", upstreamPath: "/api/chat", endpoint: "/api/chat"},
+		{name: "subpath", targetPath: "/ollama", requestPath: "/api/chat", upstreamPath: "/ollama/api/chat", endpoint: "/api/chat"},
+		{name: "subpath with trailing slash", targetPath: "/ollama/", requestPath: "/api/generate", upstreamPath: "/ollama/api/generate", endpoint: "/api/generate"},
+		{name: "client includes the subpath", targetPath: "/ollama", requestPath: "/ollama/api/chat", upstreamPath: "/ollama/api/chat", endpoint: "/api/chat"},
+		{name: "similar but other path", targetPath: "/ollama", requestPath: "/ollamax/api/chat", upstreamPath: "/ollama/ollamax/api/chat", endpoint: "/ollamax/api/chat"},
+		{name: "prefix option", prefix: "ollama", requestPath: "/api/chat", upstreamPath: "/ollama/api/chat", endpoint: "/api/chat"},
+		{name: "prefix option below target path", targetPath: "/base", prefix: "/ollama/", requestPath: "/api/chat", upstreamPath: "/base/ollama/api/chat", endpoint: "/api/chat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var upstreamPath string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				upstreamPath = r.URL.Path
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{"message":{"role":"assistant","content":"Hi"},"done":true}`)
+			}))
+			t.Cleanup(upstream.Close)
+			server, tr := newTestProxy(t, upstream.URL+tt.targetPath, Options{TargetPathPrefix: tt.prefix})
+
+			resp, err := http.Post(server.URL+tt.requestPath, "application/json", strings.NewReader(`{"model":"llama3"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if upstreamPath != tt.upstreamPath {
+				t.Errorf("upstream path = %q, want %q", upstreamPath, tt.upstreamPath)
+			}
+			calls := tr.GetCalls()
+			if len(calls) != 1 {
+				t.Fatalf("%d calls tracked, want 1", len(calls))
+			}
+			if endpoint := calls[0].Snapshot().Endpoint; endpoint != tt.endpoint {
+				t.Errorf("endpoint = %q, want %q", endpoint, tt.endpoint)
+			}
+		})
+	}
+}
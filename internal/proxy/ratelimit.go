@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket refilled at rate tokens per second, holding at most burst tokens
+type bucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64) *bucket {
+	burst := max(1, rate)
+	return &bucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// allow takes a token if one is available
+func (b *bucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retryAfter returns how long until the next token is available
+func (b *bucket) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimiter holds a bucket per endpoint suffix
+type rateLimiter struct {
+	buckets map[string]*bucket
+}
+
+// newRateLimiter creates buckets for the given requests per second by endpoint suffix.
+// Suffixes without a leading slash match a whole path segment, so "chat" limits /api/chat.
+func newRateLimiter(limits map[string]float64) *rateLimiter {
+	l := &rateLimiter{buckets: make(map[string]*bucket, len(limits))}
+	for suffix, rate := range limits {
+		if !strings.HasPrefix(suffix, "/") {
+			suffix = "/" + suffix
+		}
+		l.buckets[suffix] = newBucket(rate)
+	}
+	return l
+}
+
+// allow reports whether a request to path is within its limit, and otherwise when to retry
+func (l *rateLimiter) allow(path string) (bool, time.Duration) {
+	for suffix, b := range l.buckets {
+		if strings.HasSuffix(path, suffix) && !b.allow() {
+			return false, b.retryAfter()
+		}
+	}
+	return true, 0
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRetryWait is how long to wait before retrying a 429 response without a usable Retry-After header
+const defaultRetryWait = time.Second
+
+// retryTransport retries requests the upstream answered with 429 Too Many Requests, waiting for as long as
+// its Retry-After header asks, capped at maxWait. Only requests whose body can be read again are retried.
+type retryTransport struct {
+	base     http.RoundTripper
+	attempts int
+	maxWait  time.Duration
+
+	// onRetry is called before waiting for the given retry
+	onRetry func(req *http.Request, retry int, wait time.Duration)
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	for retry := 1; retry <= t.attempts && canRetry; retry++ {
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+
+		wait := min(retryAfter(resp.Header.Get("Retry-After"), time.Now()), t.maxWait)
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+		if t.onRetry != nil {
+			t.onRetry(req, retry, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		next := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if next.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		resp, err = t.base.RoundTrip(next)
+	}
+	return resp, err
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return defaultRetryWait
+}
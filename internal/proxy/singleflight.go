@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"ollama-proxy/internal/proxy/interceptor"
+	"ollama-proxy/internal/types"
+)
+
+// flight is the response of an in-flight request that identical requests can attach to
+type flight struct {
+	callID string
+
+	mu     sync.Mutex
+	header http.Header
+	status int
+	chunks [][]byte
+	done   bool
+	failed bool
+	// notify is closed and replaced whenever the flight makes progress
+	notify chan struct{}
+
+	// waiters counts the attached requests still replaying. The upstream request outlives the first
+	// request's client as long as there are waiters, and is canceled with cancel once the last one is gone.
+	waiters    int
+	leaderGone bool
+	cancel     context.CancelFunc
+}
+
+// leave detaches a waiter, canceling the upstream request if nobody is left to receive it
+func (f *flight) leave() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waiters--
+	if f.waiters == 0 && f.leaderGone {
+		f.cancel()
+	}
+}
+
+// abandon records that the first request's client is gone, canceling the upstream request unless
+// attached requests still wait for it
+func (f *flight) abandon() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.leaderGone = true
+	if f.waiters == 0 {
+		f.cancel()
+	}
+}
+
+// publish wakes up all attached requests; callers must hold f.mu
+func (f *flight) publish() {
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// replay streams the flight's response to w as it arrives, until the flight is done or the request is
+// canceled. It reports whether the original request failed.
+func (f *flight) replay(w http.ResponseWriter, r *http.Request) bool {
+	ctx := r.Context()
+	headerWritten := false
+	next := 0
+	for {
+		f.mu.Lock()
+		status, header, done, failed, notify := f.status, f.header, f.done, f.failed, f.notify
+		chunks := f.chunks[next:]
+		f.mu.Unlock()
+
+		if !headerWritten && status != 0 {
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(status)
+			headerWritten = true
+		}
+		if headerWritten {
+			for _, chunk := range chunks {
+				w.Write(chunk)
+			}
+			next += len(chunks)
+			if len(chunks) > 0 {
+				if flusher, ok := w.(http.Flusher); ok {
+					flusher.Flush()
+				}
+			}
+		}
+
+		if done {
+			if !headerWritten {
+				interceptor.WriteError(w, r, http.StatusBadGateway, "upstream unavailable", "the shared identical request failed")
+				return true
+			}
+			return failed
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// flightWriter records the response of the first request of a flight while forwarding it
+type flightWriter struct {
+	http.ResponseWriter
+	flight *flight
+}
+
+func (w *flightWriter) WriteHeader(status int) {
+	w.flight.mu.Lock()
+	w.flight.status = status
+	w.flight.header = w.Header().Clone()
+	w.flight.publish()
+	w.flight.mu.Unlock()
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write never fails, so that the response keeps being copied for the attached requests after the first
+// request's client is gone. The flight's context decides when the upstream request stops.
+func (w *flightWriter) Write(data []byte) (int, error) {
+	w.ResponseWriter.Write(data)
+
+	w.flight.mu.Lock()
+	w.flight.chunks = append(w.flight.chunks, bytes.Clone(data))
+	w.flight.publish()
+	w.flight.mu.Unlock()
+
+	return len(data), nil
+}
+
+func (w *flightWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives access to the forwarder, see interceptor.AsCallAwareResponse
+func (w *flightWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flightGroup tracks the in-flight requests by the hash of what is sent upstream
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// join returns the flight for key, and whether the caller started it and has to forward the request.
+// A caller attached to an existing flight has to leave it when done.
+func (g *flightGroup) join(key, callID string) (*flight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.flights[key]; ok {
+		f.mu.Lock()
+		f.waiters++
+		f.mu.Unlock()
+		return f, false
+	}
+	f := &flight{callID: callID, notify: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// finish marks the flight as done and stops new requests from attaching to it
+func (g *flightGroup) finish(key string, f *flight, failed bool) {
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+
+	f.mu.Lock()
+	f.done = true
+	f.failed = failed
+	f.publish()
+	f.mu.Unlock()
+}
+
+// credentialHeaders identify the client to the upstream. Requests with different credentials are never
+// shared, so that a client does not get a response it is not authorized for.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// flightKey identifies identical requests to the same upstream with the same credentials. The credentials
+// are read from the request itself, the call only has its headers with -capture-headers.
+func flightKey(call *types.Call, upstream string, header http.Header) string {
+	request, _ := call.Bodies()
+	hash := sha256.New()
+	for _, part := range []string{call.Method, upstream, call.Endpoint, request} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	for _, name := range credentialHeaders {
+		for _, value := range header.Values(name) {
+			hash.Write([]byte(name + ": " + value))
+			hash.Write([]byte{0})
+		}
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// serveSingleFlight forwards the first of several identical concurrent requests upstream and
+// streams its response to the others as well
+func (p *Proxy) serveSingleFlight(w http.ResponseWriter, req *http.Request, callID, key string) {
+	f, first := p.flights.join(key, callID)
+	if !first {
+		defer f.leave()
+		p.tracker.SetDuplicateOf(callID, f.callID)
+		if f.replay(w, req) {
+			if car, ok := interceptor.AsCallAwareResponse(w); ok {
+				car.MarkError()
+			}
+		}
+		return
+	}
+
+	// The upstream request is detached from the first request, whose client going away, being canceled
+	// or timing out only ends it once no attached request is left
+	ctx, cancel := context.WithCancel(context.WithoutCancel(req.Context()))
+	defer cancel()
+	f.mu.Lock()
+	f.cancel = cancel
+	f.mu.Unlock()
+	stop := context.AfterFunc(req.Context(), f.abandon)
+	defer stop()
+
+	// Deferred, so attached requests are released even if the response is aborted with a panic
+	defer func() {
+		f.mu.Lock()
+		leaderGone := f.leaderGone
+		f.mu.Unlock()
+		// Once the first request is gone its call is marked as disconnected, which says nothing about
+		// the response the attached requests received
+		car, ok := interceptor.AsCallAwareResponse(w)
+		p.flights.finish(key, f, ok && car.Errored() && !leaderGone)
+	}()
+	p.proxy.ServeHTTP(&flightWriter{ResponseWriter: w, flight: f}, req.WithContext(ctx))
+}
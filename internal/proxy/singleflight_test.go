@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
+)
+
+func TestFlightKeyCredentials(t *testing.T) {
+	call := &types.Call{Method: "POST", Endpoint: "/api/generate", Request: `{"model":"llama3","prompt":"hi"}`}
+	const upstream = "http://localhost:11434"
+	base := flightKey(call, upstream, http.Header{"Authorization": {"Bearer a"}})
+
+	tests := []struct {
+		name   string
+		header http.Header
+		same   bool
+	}{
+		{"same credentials", http.Header{"Authorization": {"Bearer a"}}, true},
+		{"other headers are ignored", http.Header{"Authorization": {"Bearer a"}, "User-Agent": {"curl"}}, true},
+		{"other token", http.Header{"Authorization": {"Bearer b"}}, false},
+		{"no credentials", http.Header{}, false},
+		{"cookie instead", http.Header{"Cookie": {"Bearer a"}}, false},
+		{"api key in addition", http.Header{"Authorization": {"Bearer a"}, "X-Api-Key": {"k"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := flightKey(call, upstream, tt.header) == base; same != tt.same {
+				t.Errorf("shared = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestSingleFlightOutlivesFirstClient(t *testing.T) {
+	const first, rest = `{"response":"a","done":false}` + "\n", `{"response":"b","done":true}` + "\n"
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, first)
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+			io.WriteString(w, rest)
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	server, tr := newTestProxy(t, upstream.URL, Options{SingleFlight: true})
+
+	post := func(ctx context.Context) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/api/generate", strings.NewReader(`{"model":"llama3","prompt":"Hi"}`))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := bufio.NewReader(resp.Body)
+		if line, err := body.ReadString('\n'); err != nil || line != first {
+			t.Fatalf("first chunk = %q, %v", line, err)
+		}
+		return resp, body
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leader, _ := post(ctx)
+	waiter, waiterBody := post(context.Background())
+	defer waiter.Body.Close()
+
+	// The first client goes away, the attached one still gets the whole response
+	cancel()
+	leader.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for !hasStatus(tr, types.StatusDisconnected) {
+		if time.Now().After(deadline) {
+			t.Fatal("the first call was not marked as disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	if got, err := io.ReadAll(waiterBody); err != nil || string(got) != rest {
+		t.Errorf("attached request received %q, %v, want %q", got, err, rest)
+	}
+}
+
+// hasStatus reports whether any tracked call has the status
+func hasStatus(tr *tracker.CallTracker, status types.CallStatus) bool {
+	for _, call := range tr.GetCalls() {
+		if call.Snapshot().Status == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ollama-proxy/internal/tracker"
+	"ollama-proxy/internal/types"
+)
+
+// NewTraceID returns a random W3C trace ID
+func NewTraceID() string {
+	return randomHex(16)
+}
+
+// NewSpanID returns a random W3C span ID
+func NewSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ParseTraceparent extracts the trace ID and parent span ID from a W3C traceparent header
+func ParseTraceparent(header string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil {
+		return "", "", false
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// Traceparent formats a sampled W3C traceparent header
+func Traceparent(traceID, spanID string) string {
+	return fmt.Sprintf("00-%s-%s-01", traceID, spanID)
+}
+
+// Exporter sends a span for every finished call to an OTLP/HTTP collector
+type Exporter struct {
+	url     string
+	tracker *tracker.CallTracker
+	client  *http.Client
+}
+
+// NewExporter creates an exporter for the collector at endpoint, e.g. http://localhost:4318
+func NewExporter(endpoint string, tracker *tracker.CallTracker) *Exporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &Exporter{
+		url:     url,
+		tracker: tracker,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run exports a span for every call that finishes, until the events channel is closed
+func (e *Exporter) Run(events <-chan types.Event) {
+	for event := range events {
+		if !event.Done {
+			continue
+		}
+		call, ok := e.tracker.GetCall(event.ID)
+		if !ok || call.TraceID == "" {
+			continue
+		}
+		go func() {
+			if err := e.export(call); err != nil {
+				log.Printf("ERROR: Failed to export span for call %s: %v", call.ID, err)
+			}
+		}()
+	}
+}
+
+// OTLP/JSON encoding of a single span, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+const (
+	spanKindServer  = 2
+	statusCodeOK    = 1
+	statusCodeError = 2
+)
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int) otlpAttribute {
+	v := strconv.Itoa(value)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &v}}
+}
+
+// span converts a finished call into an OTLP span
+func span(call types.CallSnapshot) otlpSpan {
+	end := call.StartTime.Add(time.Duration(call.DurationMs) * time.Millisecond)
+	if call.EndTime != nil {
+		end = *call.EndTime
+	}
+	code := statusCodeOK
+	if call.Status != types.StatusDone {
+		code = statusCodeError
+	}
+	return otlpSpan{
+		TraceID:           call.TraceID,
+		SpanID:            call.SpanID,
+		ParentSpanID:      call.ParentSpanID,
+		Name:              call.Method + " " + call.Endpoint,
+		Kind:              spanKindServer,
+		StartTimeUnixNano: strconv.FormatInt(call.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes: []otlpAttribute{
+			stringAttribute("http.request.method", call.Method),
+			stringAttribute("url.path", call.Endpoint),
+			intAttribute("http.response.status_code", call.StatusCode),
+			stringAttribute("gen_ai.request.model", call.Model),
+			intAttribute("gen_ai.usage.input_tokens", call.PromptTokens),
+			intAttribute("gen_ai.usage.output_tokens", call.CompletionTokens),
+			stringAttribute("ollama_proxy.status", string(call.Status)),
+			stringAttribute("ollama_proxy.upstream", call.Upstream),
+		},
+		Status: otlpStatus{Code: code, Message: call.Error},
+	}
+}
+
+func (e *Exporter) export(call *types.Call) error {
+	body, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: []otlpAttribute{stringAttribute("service.name", "ollama-proxy")}},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "ollama-proxy"},
+				Spans: []otlpSpan{span(call.Snapshot())},
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -1,7 +1,12 @@
 package tracker
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,22 +20,90 @@ type CallTracker struct {
 	maxCalls  int
 	mu        sync.RWMutex
 	eventChan chan types.Event
+
+	// eventBuffer is the capacity of eventChan and of every subscription
+	eventBuffer int
+
+	// subscribers receive a copy of every event in addition to eventChan
+	subscribers []chan types.Event
+	subMu       sync.RWMutex
+
+	// generatedTokens counts completion tokens over the whole session, including evicted calls
+	generatedTokens int
+	// transferredBytes counts request and response bytes over the whole session
+	transferredBytes int
+	// droppedEvents counts progress events not delivered because a consumer fell behind
+	droppedEvents int
+
+	// retainedBytes is the size of the request and response bodies kept in the history
+	retainedBytes int
+	// maxMemory evicts the oldest finished calls once retainedBytes exceeds it; zero disables it
+	maxMemory int
+	// evictedCalls counts calls removed from the history by -max-calls, -max-memory or -max-age
+	evictedCalls int
+
+	// compressHistory gzips the bodies of calls once they finished
+	compressHistory bool
+
+	// sequentialIDs numbers calls 1, 2, 3, ... instead of giving them UUIDs; lastID is the last number given
+	sequentialIDs bool
+	lastID        int
+
+	started time.Time
+}
+
+// Summary holds aggregate counters for the current session
+type Summary struct {
+	Active           int
+	Errors           int
+	Disconnected     int
+	RateLimited      int
+	Total            int
+	GeneratedTokens  int
+	TransferredBytes int
+	DroppedEvents    int
+
+	// RetainedBytes is the size of the request and response bodies kept in the history
+	RetainedBytes int
+	// EvictedCalls counts the calls removed from the history to make room or because they expired
+	EvictedCalls int
+	// Uptime is the time since the tracker was created
+	Uptime time.Duration
 }
 
-func NewCallTracker(maxCalls int) *CallTracker {
+// Done returns the number of calls that finished successfully
+func (s Summary) Done() int {
+	return s.Total - s.Active - s.Errors - s.Disconnected - s.RateLimited
+}
+
+// IDSchemes lists the supported kinds of call IDs
+var IDSchemes = []string{"uuid", "sequence"}
+
+// DefaultEventBuffer is the number of events buffered for each consumer unless NewCallTracker is told otherwise
+const DefaultEventBuffer = 100
+
+// NewCallTracker creates a tracker keeping at most maxCalls calls, or any number when maxCalls is zero.
+// The events channel and every subscription buffer eventBuffer events, or DefaultEventBuffer when it is zero.
+func NewCallTracker(maxCalls, eventBuffer int) *CallTracker {
+	if eventBuffer <= 0 {
+		eventBuffer = DefaultEventBuffer
+	}
 	return &CallTracker{
-		calls:     make(map[string]*types.Call),
-		maxCalls:  maxCalls,
-		eventChan: make(chan types.Event, 100), // Buffered channel to prevent blocking
+		calls:       make(map[string]*types.Call),
+		maxCalls:    maxCalls,
+		eventChan:   make(chan types.Event, eventBuffer), // Buffered channel to prevent blocking
+		eventBuffer: eventBuffer,
+		started:     time.Now(),
 	}
 }
 
-func (t *CallTracker) NewCall(method, endpoint, request string) *types.Call {
+// NewCall registers a new active call. The optional init functions can fill in
+// additional fields before the call becomes visible to other goroutines.
+func (t *CallTracker) NewCall(method, endpoint, request string, init ...func(*types.Call)) *types.Call {
 	t.mu.Lock()
-	defer t.mu.Unlock()
 
 	// Clean up old calls if we're at capacity
-	if len(t.calls) >= t.maxCalls {
+	if t.maxCalls > 0 && len(t.calls) >= t.maxCalls {
 		// Find and remove the oldest call
 		var oldestID string
 		var oldestTime time.Time
@@ -41,27 +114,39 @@ func (t *CallTracker) NewCall(method, endpoint, request string) *types.Call {
 			}
 		}
 		if oldestID != "" {
+			t.retainedBytes -= t.calls[oldestID].BodySize()
+			t.evictedCalls++
 			delete(t.calls, oldestID)
 		}
 	}
 
 	call := &types.Call{
-		ID:        uuid.New().String(),
+		ID:        t.nextID(),
 		Method:    method,
 		Endpoint:  endpoint,
 		Status:    types.StatusActive,
 		StartTime: time.Now(),
 		Request:   request,
+		BytesIn:   len(request),
+	}
+	for _, fn := range init {
+		fn(call)
 	}
 
 	t.calls[call.ID] = call
+	t.transferredBytes += call.BytesIn
+	t.retainedBytes += len(call.Request)
+	removed := t.evictForMemory()
+	t.mu.Unlock()
+
+	t.emitRemoved(removed)
 
 	// Send initial event
-	t.eventChan <- types.Event{
+	t.emit(types.Event{
 		ID:   call.ID,
 		Data: "",
 		Done: false,
-	}
+	})
 
 	return call
 }
@@ -79,48 +164,332 @@ func (t *CallTracker) withCall(id string, fn func(*types.Call)) bool {
 	return false
 }
 
+// UpdateCall appends a chunk to the response of a call and records the token counts it reports
 func (t *CallTracker) UpdateCall(id, data string) {
+	t.updateCall(id, data, true)
+}
+
+// CountCall processes a response chunk like UpdateCall, counting its tokens without keeping its content
+func (t *CallTracker) CountCall(id, data string) {
+	t.updateCall(id, data, false)
+}
+
+func (t *CallTracker) updateCall(id, data string, keep bool) {
 	t.withCall(id, func(call *types.Call) {
-		call.UpdateResponse(data)
-		t.eventChan <- types.Event{
+		if prompt, completion, ok := parseTokenCounts(data); ok {
+			call.SetTokenCounts(prompt, completion)
+			t.mu.Lock()
+			t.generatedTokens += completion
+			t.mu.Unlock()
+		}
+		if message := types.ParseError(data); message != "" {
+			call.SetError(message)
+		}
+		if stats := types.ParseStats(data); stats != nil {
+			call.SetStats(stats)
+		}
+		if keep {
+			// Append under the tracker lock so that the retained size stays in step with evictions
+			t.mu.Lock()
+			before := call.BodySize()
+			call.UpdateResponse(data)
+			if t.calls[id] == call {
+				t.retainedBytes += call.BodySize() - before
+			}
+			removed := t.evictForMemory()
+			t.mu.Unlock()
+			t.emitRemoved(removed)
+		} else {
+			data = ""
+		}
+		t.emit(types.Event{
 			ID:   id,
 			Data: data,
 			Done: false,
-		}
+		})
 	})
 }
 
+// SetUpstream records which upstream the call was routed to
+func (t *CallTracker) SetUpstream(id, upstream string) {
+	t.withCall(id, func(call *types.Call) {
+		call.SetUpstream(upstream)
+	})
+}
+
+// AddBytesOut counts response bytes received for a call
+func (t *CallTracker) AddBytesOut(id string, n int) {
+	t.withCall(id, func(call *types.Call) {
+		call.AddBytesOut(n)
+		t.mu.Lock()
+		t.transferredBytes += n
+		t.mu.Unlock()
+	})
+}
+
+// SetNote attaches a note to a call, or removes it when note is empty
+func (t *CallTracker) SetNote(id, note string) {
+	t.withCall(id, func(call *types.Call) {
+		call.SetNote(note)
+		t.emit(types.Event{ID: id})
+	})
+}
+
+// SetDuplicateOf links a call to the identical call whose response it shares
+func (t *CallTracker) SetDuplicateOf(id, originalID string) {
+	t.withCall(id, func(call *types.Call) {
+		call.SetDuplicateOf(originalID)
+	})
+}
+
+// RetryCall counts a retry of a call the upstream rejected with 429
+func (t *CallTracker) RetryCall(id string) {
+	t.withCall(id, func(call *types.Call) {
+		call.AddRetry()
+		t.emit(types.Event{
+			ID:   id,
+			Data: "",
+			Done: false,
+		})
+	})
+}
+
+// SetStatusCode records the HTTP status code returned for a call
+func (t *CallTracker) SetStatusCode(id string, code int) {
+	t.withCall(id, func(call *types.Call) {
+		call.SetStatusCode(code)
+	})
+}
+
+// SetResponseHeaders records the response headers of a call
+func (t *CallTracker) SetResponseHeaders(id string, header http.Header) {
+	t.withCall(id, func(call *types.Call) {
+		call.SetResponseHeaders(header)
+	})
+}
+
+// parseTokenCounts extracts the token counts Ollama reports in the final response object
+func parseTokenCounts(data string) (prompt, completion int, ok bool) {
+	if !strings.Contains(data, `"eval_count"`) {
+		return 0, 0, false
+	}
+
+	var counts struct {
+		PromptEvalCount int  `json:"prompt_eval_count"`
+		EvalCount       *int `json:"eval_count"`
+	}
+	if err := json.Unmarshal([]byte(data), &counts); err != nil || counts.EvalCount == nil {
+		return 0, 0, false
+	}
+	return counts.PromptEvalCount, *counts.EvalCount, true
+}
+
 func (t *CallTracker) CompleteCall(id string) {
 	t.withCall(id, func(call *types.Call) {
-		call.MarkDone()
-		t.eventChan <- types.Event{
+		if !call.MarkDone() {
+			return
+		}
+		t.compressFinished(call)
+		t.emit(types.Event{
 			ID:   id,
 			Data: "",
 			Done: true,
-		}
+		})
 	})
 }
 
+// ErrorCall marks a call as failed
 func (t *CallTracker) ErrorCall(id string) {
 	t.withCall(id, func(call *types.Call) {
-		call.MarkError()
-		t.eventChan <- types.Event{
+		if !call.MarkError() {
+			return
+		}
+		t.compressFinished(call)
+		t.emit(types.Event{
 			ID:   id,
 			Data: "Error occurred",
 			Done: true,
-		}
+		})
 	})
 }
 
+// DisconnectCall marks a call as aborted because the client went away
 func (t *CallTracker) DisconnectCall(id string) {
 	t.withCall(id, func(call *types.Call) {
-		call.MarkDisconnected()
-		t.eventChan <- types.Event{
+		if !call.MarkDisconnected() {
+			return
+		}
+		t.compressFinished(call)
+		t.emit(types.Event{
 			ID:   id,
 			Data: "Client disconnected",
 			Done: true,
+		})
+	})
+}
+
+// FinishCall marks a call that seems stuck as done, or as failed, and aborts its upstream request.
+// It reports false if the call does not exist or is no longer active.
+func (t *CallTracker) FinishCall(id string, failed bool) bool {
+	status := types.StatusDone
+	if failed {
+		status = types.StatusError
+	}
+	finished := false
+	t.withCall(id, func(call *types.Call) {
+		if finished = call.FinishByHand(status); finished {
+			t.compressFinished(call)
+			t.emit(types.Event{
+				ID:   id,
+				Data: "Finished by hand",
+				Done: true,
+			})
 		}
 	})
+	return finished
+}
+
+// SetCancel registers how to abort the upstream request of a call, used by FinishCall
+func (t *CallTracker) SetCancel(id string, cancel func()) {
+	t.withCall(id, func(call *types.Call) {
+		call.SetCancel(cancel)
+	})
+}
+
+// ExpireCalls periodically removes finished calls that ended more than maxAge ago from the history.
+// Active calls are kept regardless of their age. It never returns.
+func (t *CallTracker) ExpireCalls(maxAge time.Duration) {
+	interval := min(max(maxAge/10, time.Second), time.Minute)
+	for range time.Tick(interval) {
+		t.removeExpired(time.Now().Add(-maxAge))
+	}
+}
+
+// removeExpired drops the finished calls that ended before cutoff
+func (t *CallTracker) removeExpired(cutoff time.Time) {
+	var removed []string
+	t.mu.Lock()
+	for id, call := range t.calls {
+		if !call.IsActive() && call.StartTime.Add(call.Duration()).Before(cutoff) {
+			t.retainedBytes -= call.BodySize()
+			t.evictedCalls++
+			delete(t.calls, id)
+			removed = append(removed, id)
+		}
+	}
+	t.mu.Unlock()
+
+	t.emitRemoved(removed)
+}
+
+// SetIDScheme selects how new calls are named: "uuid" (the default) gives them random UUIDs, "sequence"
+// numbers them 1, 2, 3, ... in the order they arrive, which is shorter to read and unique within the session
+func (t *CallTracker) SetIDScheme(scheme string) error {
+	switch scheme {
+	case "uuid", "sequence":
+	default:
+		return fmt.Errorf("unknown ID scheme %q, expected uuid or sequence", scheme)
+	}
+	t.mu.Lock()
+	t.sequentialIDs = scheme == "sequence"
+	t.mu.Unlock()
+	return nil
+}
+
+// nextID returns the ID for a new call. The caller must hold t.mu.
+func (t *CallTracker) nextID() string {
+	if !t.sequentialIDs {
+		return uuid.New().String()
+	}
+	t.lastID++
+	return strconv.Itoa(t.lastID)
+}
+
+// SetCompressHistory enables gzipping the request and response of every call that finishes, which
+// trades the CPU time to compress and to decompress them when they are read for memory
+func (t *CallTracker) SetCompressHistory(enabled bool) {
+	t.mu.Lock()
+	t.compressHistory = enabled
+	t.mu.Unlock()
+}
+
+// compressFinished compresses the bodies of a call that just finished if enabled, keeping the
+// retained size in step
+func (t *CallTracker) compressFinished(call *types.Call) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.compressHistory {
+		return
+	}
+	before := call.BodySize()
+	call.Compress()
+	if t.calls[call.ID] == call {
+		t.retainedBytes += call.BodySize() - before
+	}
+}
+
+// SetMaxMemory sets the budget for the request and response bodies kept in the history. Once it
+// is exceeded the oldest finished calls are removed; calls in progress are kept. Zero disables it.
+func (t *CallTracker) SetMaxMemory(bytes int) {
+	t.mu.Lock()
+	t.maxMemory = bytes
+	removed := t.evictForMemory()
+	t.mu.Unlock()
+
+	t.emitRemoved(removed)
+}
+
+// evictForMemory drops the oldest finished calls until the retained bodies fit into maxMemory
+// and returns their IDs. The caller must hold t.mu.
+func (t *CallTracker) evictForMemory() []string {
+	if t.maxMemory <= 0 || t.retainedBytes <= t.maxMemory {
+		return nil
+	}
+
+	var finished []*types.Call
+	for _, call := range t.calls {
+		if !call.IsActive() {
+			finished = append(finished, call)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].StartTime.Before(finished[j].StartTime)
+	})
+
+	var removed []string
+	for _, call := range finished {
+		if t.retainedBytes <= t.maxMemory {
+			break
+		}
+		t.retainedBytes -= call.BodySize()
+		t.evictedCalls++
+		delete(t.calls, call.ID)
+		removed = append(removed, call.ID)
+	}
+	return removed
+}
+
+// emitRemoved announces calls that were dropped from the history
+func (t *CallTracker) emitRemoved(ids []string) {
+	for _, id := range ids {
+		t.emit(types.Event{
+			ID:      id,
+			Removed: true,
+		})
+	}
+}
+
+// RateLimitCall marks a call as rejected by the rate limit
+func (t *CallTracker) RateLimitCall(id string) {
+	t.withCall(id, func(call *types.Call) {
+		call.MarkRateLimited()
+		t.compressFinished(call)
+		t.emit(types.Event{
+			ID:   id,
+			Data: "Rate limited",
+			Done: true,
+		})
+	})
 }
 
 func (t *CallTracker) GetCalls() []*types.Call {
@@ -140,6 +509,35 @@ func (t *CallTracker) GetCalls() []*types.Call {
 	return calls
 }
 
+// Summary returns aggregate counters for the current session
+func (t *CallTracker) Summary() Summary {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	summary := Summary{
+		Total:            len(t.calls),
+		GeneratedTokens:  t.generatedTokens,
+		TransferredBytes: t.transferredBytes,
+		DroppedEvents:    t.droppedEvents,
+		RetainedBytes:    t.retainedBytes,
+		EvictedCalls:     t.evictedCalls,
+		Uptime:           time.Since(t.started),
+	}
+	for _, call := range t.calls {
+		switch call.CurrentStatus() {
+		case types.StatusActive:
+			summary.Active++
+		case types.StatusError:
+			summary.Errors++
+		case types.StatusDisconnected:
+			summary.Disconnected++
+		case types.StatusRateLimited:
+			summary.RateLimited++
+		}
+	}
+	return summary
+}
+
 func (t *CallTracker) GetCall(id string) (*types.Call, bool) {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -151,3 +549,41 @@ func (t *CallTracker) GetCall(id string) (*types.Call, bool) {
 func (t *CallTracker) Events() <-chan types.Event {
 	return t.eventChan
 }
+
+// Subscribe returns a new channel that receives every event from now on.
+// Progress events are dropped while the channel is full, Done events are always delivered.
+func (t *CallTracker) Subscribe() <-chan types.Event {
+	ch := make(chan types.Event, t.eventBuffer)
+	t.subMu.Lock()
+	t.subscribers = append(t.subscribers, ch)
+	t.subMu.Unlock()
+	return ch
+}
+
+// emit delivers an event to the events channel and all subscribers.
+// Consumers only use events as a hint to re-read the call, so progress events are dropped
+// instead of stalling the proxy when a consumer falls behind. Done and Removed events are never dropped,
+// a consumer that missed them would show a call as running or keep a call the history no longer has.
+func (t *CallTracker) emit(event types.Event) {
+	t.send(t.eventChan, event)
+
+	t.subMu.RLock()
+	defer t.subMu.RUnlock()
+	for _, ch := range t.subscribers {
+		t.send(ch, event)
+	}
+}
+
+func (t *CallTracker) send(ch chan types.Event, event types.Event) {
+	if event.Done || event.Removed {
+		ch <- event
+		return
+	}
+	select {
+	case ch <- event:
+	default:
+		t.mu.Lock()
+		t.droppedEvents++
+		t.mu.Unlock()
+	}
+}
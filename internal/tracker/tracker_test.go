@@ -0,0 +1,95 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+
+	"ollama-proxy/internal/types"
+)
+
+// drainWhile runs fn while discarding the events it emits, so that Done events do not block it
+func drainWhile(t *testing.T, tr *CallTracker, fn func()) {
+	t.Helper()
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		fn()
+	}()
+	for {
+		select {
+		case <-tr.Events():
+		case <-finished:
+			for {
+				select {
+				case <-tr.Events():
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestRemovedEventsAreNotDropped(t *testing.T) {
+	const calls = 5
+	tr := NewCallTracker(0, 1)
+	drainWhile(t, tr, func() {
+		for range calls {
+			call := tr.NewCall("POST", "/api/generate", `{}`)
+			tr.CompleteCall(call.ID)
+		}
+	})
+
+	// The consumer only starts reading once every removal was announced, far more than fit into the buffer
+	go tr.removeExpired(time.Now().Add(time.Hour))
+	removed := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for len(removed) < calls {
+		select {
+		case event := <-tr.Events():
+			if event.Removed {
+				removed[event.ID] = true
+			}
+		case <-timeout:
+			t.Fatalf("got %d of %d removed events", len(removed), calls)
+		}
+	}
+	if left := tr.GetCalls(); len(left) != 0 {
+		t.Errorf("%d calls left in the history, want none", len(left))
+	}
+}
+
+func TestDroppedProgressEventsAreCounted(t *testing.T) {
+	tr := NewCallTracker(0, 1)
+	call := tr.NewCall("POST", "/api/generate", `{}`)
+	tr.UpdateCall(call.ID, `{"response":"a","done":false}`)
+	tr.UpdateCall(call.ID, `{"response":"b","done":false}`)
+
+	if got := tr.Summary().DroppedEvents; got != 2 {
+		t.Errorf("DroppedEvents = %d, want 2", got)
+	}
+	if event := <-tr.Events(); event.ID != call.ID || event.Done || event.Removed {
+		t.Errorf("first event = %+v, want the new call", event)
+	}
+	if status := call.Snapshot().Status; status != types.StatusActive {
+		t.Errorf("Status = %s, want %s", status, types.StatusActive)
+	}
+}
+
+func TestDisconnectCall(t *testing.T) {
+	tr := NewCallTracker(0, 10)
+	call := tr.NewCall("POST", "/api/chat", `{}`)
+	<-tr.Events()
+
+	tr.DisconnectCall(call.ID)
+	event := <-tr.Events()
+	if event.ID != call.ID || !event.Done || event.Data != "Client disconnected" {
+		t.Errorf("event = %+v, want the call done with a disconnect marker", event)
+	}
+	if call.IsActive() || call.Status != types.StatusDisconnected {
+		t.Errorf("Status = %s, want %s", call.Status, types.StatusDisconnected)
+	}
+	if got := tr.Summary().Disconnected; got != 1 {
+		t.Errorf("Summary().Disconnected = %d, want 1", got)
+	}
+}
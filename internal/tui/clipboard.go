@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"strings"
+
+	"ollama-proxy/internal/types"
+)
+
+// copyToClipboard puts text on the terminal's clipboard with the OSC 52 escape sequence, which also works
+// over SSH. It is sent with the next draw; terminals without support ignore it.
+func (t *TUI) copyToClipboard(text string) {
+	t.clipboard = []byte(text)
+}
+
+// curlCommand returns a shell command that sends the request of a call to base with curl
+func curlCommand(call types.CallSnapshot, base string) string {
+	url := strings.TrimSuffix(base, "/") + call.Endpoint
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "curl -X %s %s", call.Method, shellQuote(url))
+	if call.Request != "" {
+		fmt.Fprintf(&sb, " -H 'Content-Type: application/json' --data-raw %s", shellQuote(call.Request))
+	}
+	return sb.String()
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// copyAsCurl copies a curl command reproducing the selected call to the clipboard. It is sent to the
+// curl base if one is configured, or else to the upstream the call went to.
+func (t *TUI) copyAsCurl() {
+	if t.noCurl {
+		log.Printf("WARN: Calls cannot be copied as curl with -no-bodies or -redact, the stored requests differ from the ones sent")
+		return
+	}
+	call, ok := t.tracker.GetCall(t.selectedID)
+	if !ok {
+		return
+	}
+	snapshot := call.Snapshot()
+	if snapshot.RequestStreamed {
+		log.Printf("WARN: The request of call %s was not captured, it cannot be copied as curl", call.ID)
+		return
+	}
+	base := cmp.Or(t.curlBase, snapshot.Upstream)
+	if base == "" {
+		log.Printf("WARN: Call %s was not sent upstream, set -curl-base to copy it as curl", call.ID)
+		return
+	}
+	t.copyToClipboard(curlCommand(snapshot, base))
+	log.Printf("Copied call %s as curl command to the clipboard", call.ID)
+}
@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"ollama-proxy/internal/types"
+)
+
+// maxDiffLines bounds the size of the inputs to the quadratic line diff
+const maxDiffLines = 2000
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffRemoved
+	diffAdded
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// diffLines computes a line diff turning a into b from their longest common subsequence
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, diffLine{diffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, diffLine{diffRemoved, a[i]})
+			i++
+		default:
+			diff = append(diff, diffLine{diffAdded, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, diffLine{diffRemoved, a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, diffLine{diffAdded, b[j]})
+	}
+	return diff
+}
+
+// formatDiff renders the line diff between a baseline and another text, with removed lines
+// prefixed by "-" and added lines by "+"
+func formatDiff(title, baseline, other string, opts formatOptions) string {
+	th := opts.theme
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s]%s:[%s]\n", th.Prompt, title, th.Text))
+
+	a := strings.Split(strings.TrimSpace(baseline), "\n")
+	b := strings.Split(strings.TrimSpace(other), "\n")
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		sb.WriteString(fmt.Sprintf("(too large to compare: %d and %d lines)\n", len(a), len(b)))
+		return sb.String()
+	}
+
+	for _, line := range diffLines(a, b) {
+		text := tview.Escape(line.text)
+		switch line.op {
+		case diffRemoved:
+			sb.WriteString(fmt.Sprintf("[%s]- %s[%s]\n", th.DiffRemoved, text, th.Text))
+		case diffAdded:
+			sb.WriteString(fmt.Sprintf("[%s]+ %s[%s]\n", th.DiffAdded, text, th.Text))
+		default:
+			sb.WriteString("  " + text + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// indentJSON pretty-prints a JSON body so that it can be compared line by line
+func indentJSON(body string) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(body), "", "  "); err != nil {
+		return body
+	}
+	return out.String()
+}
+
+// formatCallDiff compares the request and the response text of a call against the baseline call
+func formatCallDiff(baseline, call *types.Call, opts formatOptions) string {
+	th := opts.theme
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s]Compared to baseline:[%s] %s (b to clear)\n\n", th.Model, th.Text, baseline.ID))
+	baselineRequest, _ := baseline.Bodies()
+	request, _ := call.Bodies()
+	sb.WriteString(formatDiff("Request", indentJSON(baselineRequest), indentJSON(request), opts))
+	sb.WriteString("\n")
+	sb.WriteString(formatDiff("Response", baseline.ResponseText(), call.ResponseText(), opts))
+	return sb.String()
+}
@@ -0,0 +1,112 @@
+package tui
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"ollama-proxy/internal/types"
+)
+
+// rawDocument lays out a call as one JSON document for an editor: the request as sent and the response
+// objects in the order they arrived. Parts that are not JSON are kept as strings.
+func rawDocument(call types.CallSnapshot) []byte {
+	doc := struct {
+		ID       string            `json:"id"`
+		Method   string            `json:"method"`
+		Endpoint string            `json:"endpoint"`
+		Model    string            `json:"model,omitempty"`
+		Request  json.RawMessage   `json:"request"`
+		Response []json.RawMessage `json:"response"`
+	}{call.ID, call.Method, call.Endpoint, call.Model, rawOrString(call.Request), responseObjects(call.Response)}
+
+	data, _ := json.MarshalIndent(doc, "", "  ")
+	return append(data, '\n')
+}
+
+// responseObjects splits a response into its JSON objects, or the data of its events for server-sent events
+func responseObjects(response string) []json.RawMessage {
+	objects := []json.RawMessage{}
+	if strings.HasPrefix(strings.TrimSpace(response), "data:") {
+		for line := range strings.Lines(response) {
+			if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:"); ok {
+				objects = append(objects, rawOrString(strings.TrimSpace(data)))
+			}
+		}
+		return objects
+	}
+
+	dec := json.NewDecoder(strings.NewReader(response))
+	for {
+		start := dec.InputOffset()
+		var object json.RawMessage
+		err := dec.Decode(&object)
+		if err == io.EOF {
+			return objects
+		}
+		if err != nil {
+			// The rest is not JSON, e.g. a response cut off by the upstream
+			return append(objects, rawOrString(strings.TrimSpace(response[start:])))
+		}
+		objects = append(objects, object)
+	}
+}
+
+// rawOrString returns s itself if it is JSON, or else s as a JSON string
+func rawOrString(s string) json.RawMessage {
+	if json.Valid([]byte(s)) {
+		var buf bytes.Buffer
+		json.Compact(&buf, []byte(s))
+		return buf.Bytes()
+	}
+	data, _ := json.Marshal(s)
+	return data
+}
+
+// openInEditor writes the raw request and response of the selected call to a temporary file and opens it
+// in $EDITOR, or $PAGER without one, with the TUI suspended until it exits. Live updates are paused
+// meanwhile, the UI catches up afterwards.
+func (t *TUI) openInEditor() {
+	call, ok := t.tracker.GetCall(t.selectedID)
+	if !ok {
+		return
+	}
+
+	command := strings.Fields(cmp.Or(os.Getenv("EDITOR"), os.Getenv("PAGER")))
+	if len(command) == 0 {
+		log.Printf("WARN: Set $EDITOR or $PAGER to open calls in an editor")
+		return
+	}
+
+	file, err := os.CreateTemp("", "ollama-proxy-"+call.ID+"-*.json")
+	if err == nil {
+		_, err = file.Write(rawDocument(call.Snapshot()))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to write call %s for the editor: %v", call.ID, err)
+		return
+	}
+	defer os.Remove(file.Name())
+
+	wasPaused := t.paused.Swap(true)
+	t.app.Suspend(func() {
+		cmd := exec.Command(command[0], append(command[1:], file.Name())...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err = cmd.Run()
+	})
+	if err != nil {
+		log.Printf("ERROR: %s exited with: %v", command[0], err)
+	}
+	t.paused.Store(wasPaused)
+	if !wasPaused {
+		t.catchUp()
+	}
+}
@@ -0,0 +1,88 @@
+package tui
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"ollama-proxy/internal/types"
+)
+
+// endpointFilter limits the call list to one kind of endpoint
+type endpointFilter struct {
+	name     string
+	suffixes []string // nil matches every endpoint no other filter matches
+}
+
+// endpointFilters are cycled through with e, after showing all calls
+var endpointFilters = []endpointFilter{
+	{"chat", []string{"/api/chat", "/v1/chat/completions"}},
+	{"generate", []string{"/api/generate", "/v1/completions"}},
+	{"embeddings", []string{"/api/embed", "/api/embeddings", "/v1/embeddings"}},
+	{"models", []string{"/api/tags", "/api/show", "/api/ps", "/v1/models"}},
+	{"other", nil},
+}
+
+// matches reports whether a call to the endpoint is shown by the filter
+func (f endpointFilter) matches(endpoint string) bool {
+	if f.suffixes == nil {
+		return !slices.ContainsFunc(endpointFilters, func(other endpointFilter) bool {
+			return other.suffixes != nil && other.matches(endpoint)
+		})
+	}
+	return slices.ContainsFunc(f.suffixes, func(suffix string) bool {
+		return strings.HasSuffix(endpoint, suffix)
+	})
+}
+
+// cycleEndpointFilter switches to the next endpoint filter, wrapping around to showing all calls
+func (t *TUI) cycleEndpointFilter() {
+	i := slices.IndexFunc(endpointFilters, func(f endpointFilter) bool { return f.name == t.endpointFilter })
+	t.endpointFilter = ""
+	if i+1 < len(endpointFilters) {
+		t.endpointFilter = endpointFilters[i+1].name
+	}
+	t.updateListTitle()
+	t.updateCallList()
+}
+
+// filterCalls drops the calls hidden by the endpoint filter and, in the errors-only view, the calls that
+// did not fail
+func (t *TUI) filterCalls(calls []*types.Call) []*types.Call {
+	if t.errorsOnly {
+		calls = slices.DeleteFunc(calls, func(call *types.Call) bool {
+			status := call.CurrentStatus()
+			return status != types.StatusError && status != types.StatusDisconnected
+		})
+	}
+
+	i := slices.IndexFunc(endpointFilters, func(f endpointFilter) bool { return f.name == t.endpointFilter })
+	if i < 0 {
+		return calls
+	}
+	return slices.DeleteFunc(calls, func(call *types.Call) bool {
+		return !endpointFilters[i].matches(call.Endpoint)
+	})
+}
+
+// formatFailure describes why a call failed for its entry in the errors-only view: the HTTP status code
+// and the error message, or that the client went away
+func formatFailure(call *types.Call) string {
+	snapshot := call.Snapshot()
+	var parts []string
+	if snapshot.StatusCode != 0 {
+		parts = append(parts, strconv.Itoa(snapshot.StatusCode))
+	}
+	switch {
+	case snapshot.Error != "":
+		parts = append(parts, tview.Escape(snapshot.Error))
+	case snapshot.Status == types.StatusDisconnected:
+		parts = append(parts, "client disconnected")
+	}
+	if parts == nil {
+		return ""
+	}
+	return " " + strings.Join(parts, " ") + " —"
+}
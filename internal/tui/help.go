@@ -0,0 +1,121 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	mainPage  = "main"
+	helpPage  = "help"
+	statsPage = "stats"
+	quitPage  = "quit"
+)
+
+type keyBinding struct {
+	keys        string
+	description string
+}
+
+// keyBindings lists all keybindings shown in the help overlay
+var keyBindings = []keyBinding{
+	{"↑/↓ or j/k", "Navigate calls / scroll"},
+	{"g/G or Home/End", "Jump to top/bottom, i.e. the newest/oldest call in the list"},
+	{"Ctrl+D/Ctrl+U", "Move half a page down/up"},
+	{"Enter", "Select call"},
+	{"Tab / Shift+Tab", "Switch panel"},
+	{"Esc", "Back to call list"},
+	{"/", "Search in details (empty search clears)"},
+	{"n/N", "Next/previous search match"},
+	{"n (call list)", "Write a note on the selected call (empty removes it)"},
+	{"o", "Toggle newest/oldest first"},
+	{"f", "Toggle following the newest active call"},
+	{"e", "Cycle showing only chat, generate, embeddings, model or other calls"},
+	{"!", "Show only errored and disconnected calls with their errors"},
+	{"Space", "Pause/resume live updates"},
+	{"L", "Cycle minimum log level"},
+	{"< / >", "Shrink/grow the call list"},
+	{"r", "Toggle formatted/raw details"},
+	{"b", "Mark/clear baseline to diff other calls against"},
+	{"x", "Replay selected call against the upstream"},
+	{"y", "Copy the selected call as a curl command to the clipboard"},
+	{"v", "Open the raw request and response of the selected call in $EDITOR"},
+	{"C / E", "Mark a stuck active call as done/failed and abort it"},
+	{"t", "Export the conversation of the selected chat call to markdown"},
+	{"c", "Group calls by conversation thread (Enter expands/collapses)"},
+	{"S", "Toggle per-model statistics"},
+	{"p", "Expand/collapse request parameters"},
+	{"T", "Expand/collapse model reasoning"},
+	{"?", "Toggle this help"},
+	{"q", "Quit (asks first while calls are active)"},
+}
+
+// centered wraps a primitive so it is drawn in the middle of the screen with the given size.
+// A width of 0 uses 90% of the screen width.
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	proportion := 0
+	if width == 0 {
+		proportion = 18
+	}
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 0, true).
+			AddItem(nil, 0, 1, false), width, proportion, true).
+		AddItem(nil, 0, 1, false)
+}
+
+func formatHelp(th Theme) string {
+	width := 0
+	for _, kb := range keyBindings {
+		width = max(width, tview.TaggedStringWidth(kb.keys))
+	}
+
+	var sb strings.Builder
+	for _, kb := range keyBindings {
+		padding := strings.Repeat(" ", width-tview.TaggedStringWidth(kb.keys))
+		sb.WriteString(fmt.Sprintf(" [%s]%s[%s]%s  %s\n", th.Model, tview.Escape(kb.keys), th.Text, padding, kb.description))
+	}
+	return sb.String()
+}
+
+func (t *TUI) setupHelp() {
+	t.helpView = tview.NewTextView().SetDynamicColors(true).SetScrollable(true)
+	t.helpView.SetBorder(true).SetTitle(" Help (? or Esc to close) ")
+	t.helpView.SetText(formatHelp(t.formatOpts.theme))
+	t.helpView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEscape,
+			event.Key() == tcell.KeyRune && event.Rune() == '?':
+			t.toggleHelp()
+			return nil
+		}
+		return event
+	})
+
+	t.pages.AddPage(helpPage, centered(t.helpView, 60, len(keyBindings)+2), true, false)
+}
+
+// toggleHelp shows or hides the help overlay
+func (t *TUI) toggleHelp() {
+	t.toggleOverlay(helpPage, t.helpView)
+}
+
+// toggleOverlay shows or hides an overlay page, restoring the previous focus when closing
+func (t *TUI) toggleOverlay(name string, focus tview.Primitive) {
+	if front, _ := t.pages.GetFrontPage(); front == name {
+		t.pages.HidePage(name)
+		if t.overlayReturnFocus != nil {
+			t.app.SetFocus(t.overlayReturnFocus)
+		}
+		return
+	}
+
+	t.overlayReturnFocus = t.app.GetFocus()
+	t.pages.ShowPage(name)
+	t.app.SetFocus(focus)
+}
@@ -0,0 +1,67 @@
+package tui
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// halfPage returns half the inner height of a primitive, used for Ctrl+D/Ctrl+U scrolling
+func halfPage(box interface{ GetInnerRect() (int, int, int, int) }) int {
+	_, _, _, height := box.GetInnerRect()
+	return max(1, height/2)
+}
+
+// listVimKeys maps vim-style navigation keys onto a list.
+// j/k move the selection, g/G jump to the top/bottom and Ctrl+D/Ctrl+U move by half a page.
+func listVimKeys(list *tview.List, event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyCtrlD:
+		list.SetCurrentItem(min(list.GetCurrentItem()+halfPage(list), list.GetItemCount()-1))
+		return nil
+	case tcell.KeyCtrlU:
+		list.SetCurrentItem(max(list.GetCurrentItem()-halfPage(list), 0))
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'j':
+			return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+		case 'k':
+			return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+		case 'g':
+			return tcell.NewEventKey(tcell.KeyHome, 0, tcell.ModNone)
+		case 'G':
+			return tcell.NewEventKey(tcell.KeyEnd, 0, tcell.ModNone)
+		}
+	}
+	return event
+}
+
+// isListNavigation reports whether a key moves the selection of a list, including the vim-style keys
+func isListNavigation(event *tcell.EventKey) bool {
+	switch event.Key() {
+	case tcell.KeyUp, tcell.KeyDown, tcell.KeyHome, tcell.KeyEnd, tcell.KeyPgUp, tcell.KeyPgDn, tcell.KeyCtrlD, tcell.KeyCtrlU:
+		return true
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'j', 'k', 'g', 'G':
+			return true
+		}
+	}
+	return false
+}
+
+// textViewVimKeys adds half-page scrolling to a text view.
+// TextView already handles j/k/g/G natively.
+func textViewVimKeys(view *tview.TextView, event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyCtrlD:
+		row, col := view.GetScrollOffset()
+		view.ScrollTo(row+halfPage(view), col)
+		return nil
+	case tcell.KeyCtrlU:
+		row, col := view.GetScrollOffset()
+		view.ScrollTo(max(row-halfPage(view), 0), col)
+		return nil
+	}
+	return event
+}
@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+func (l logLevel) String() string {
+	switch l {
+	case levelDebug:
+		return "DEBUG"
+	case levelWarn:
+		return "WARN"
+	case levelError:
+		return "ERROR"
+	default:
+		return "INFO"
+	}
+}
+
+type logEntry struct {
+	level logLevel
+	text  string
+}
+
+// parseLogLevel detects the level of a log line. Messages may start with a level prefix
+// such as "ERROR:" (after the standard logger's timestamp) or use slog's "level=" attribute.
+// Lines without a level are treated as info.
+func parseLogLevel(line string) logLevel {
+	for _, level := range []logLevel{levelDebug, levelWarn, levelError, levelInfo} {
+		name := level.String()
+		if strings.Contains(line, "level="+name) || strings.Contains(line, " "+name+":") || strings.HasPrefix(line, name+":") {
+			return level
+		}
+	}
+	return levelInfo
+}
+
+// logColor returns the theme color used for log lines of the given level
+func (th Theme) logColor(level logLevel) string {
+	switch level {
+	case levelError:
+		return th.LogError
+	case levelWarn:
+		return th.LogWarn
+	case levelDebug:
+		return th.LogDebug
+	default:
+		return ""
+	}
+}
+
+// formatLogEntry colors a log line according to its level
+func formatLogEntry(entry logEntry, th Theme) string {
+	color := th.logColor(entry.level)
+	if color == "" {
+		return entry.text
+	}
+	text := strings.TrimSuffix(entry.text, "\n")
+	return fmt.Sprintf("[%s]%s[%s]\n", color, text, th.Text)
+}
+
+// appendLog records a log message and shows it if it passes the level filter
+func (t *TUI) appendLog(msg string) {
+	for _, line := range strings.SplitAfter(msg, "\n") {
+		if line == "" {
+			continue
+		}
+		entry := logEntry{level: parseLogLevel(line), text: line}
+		t.logEntries = append(t.logEntries, entry)
+		// The text view trims itself to maxLogLines, the entries kept for re-filtering are
+		// trimmed in batches so that appending stays cheap
+		if len(t.logEntries) >= 2*t.maxLogLines {
+			t.logEntries = slices.Clone(t.logEntries[len(t.logEntries)-t.maxLogLines:])
+		}
+		if entry.level >= t.minLogLevel {
+			fmt.Fprint(t.logView, formatLogEntry(entry, t.formatOpts.theme))
+		}
+	}
+	t.logView.ScrollToEnd()
+}
+
+// cycleLogLevel raises the minimum level shown in the log view, wrapping around to debug
+func (t *TUI) cycleLogLevel() {
+	t.minLogLevel = (t.minLogLevel + 1) % (levelError + 1)
+	t.updateLogTitle()
+	t.renderLog()
+}
+
+// renderLog redraws the log view from the recorded entries
+func (t *TUI) renderLog() {
+	var sb strings.Builder
+	for _, entry := range t.logEntries {
+		if entry.level >= t.minLogLevel {
+			sb.WriteString(formatLogEntry(entry, t.formatOpts.theme))
+		}
+	}
+	t.logView.SetText(sb.String())
+	t.logView.ScrollToEnd()
+}
+
+// updateLogTitle shows the active level filter in the log view title
+func (t *TUI) updateLogTitle() {
+	if t.minLogLevel == levelDebug {
+		t.logView.SetTitle(" Log ")
+		return
+	}
+	t.logView.SetTitle(fmt.Sprintf(" Log (%s+) ", t.minLogLevel))
+}
@@ -0,0 +1,32 @@
+package tui
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+func (t *TUI) setupNote() {
+	t.noteInput = tview.NewInputField().SetLabel("Note: ")
+	t.noteInput.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			t.tracker.SetNote(t.noteCallID, t.noteInput.GetText())
+			t.updateCallList()
+			t.updateDetailView()
+		}
+		t.flex.ResizeItem(t.noteInput, 0, 0)
+		t.app.SetFocus(t.callList)
+	})
+}
+
+// openNote shows a prompt below the detail view to write or edit the note on the selected call.
+// An empty note removes it.
+func (t *TUI) openNote() {
+	call, ok := t.tracker.GetCall(t.selectedID)
+	if !ok {
+		return
+	}
+	t.noteCallID = call.ID
+	t.noteInput.SetText(call.Snapshot().Note)
+	t.flex.ResizeItem(t.noteInput, 1, 0)
+	t.app.SetFocus(t.noteInput)
+}
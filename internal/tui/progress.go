@@ -0,0 +1,91 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"ollama-proxy/internal/types"
+)
+
+// progressBarWidth is the width in cells of the progress bars of pulls, pushes and model creation
+const progressBarWidth = 30
+
+// isProgressEndpoint reports whether an endpoint streams progress objects, like /api/pull does
+func isProgressEndpoint(endpoint string) bool {
+	for _, suffix := range []string{"/api/pull", "/api/push", "/api/create"} {
+		if strings.HasSuffix(endpoint, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatProgress renders the progress stream of /api/pull, /api/push or /api/create: a bar for every layer
+// transferred, in the order they started, and the latest status
+func formatProgress(request, response string, opts formatOptions) string {
+	th := opts.theme
+	type layer struct {
+		digest           string
+		completed, total int64
+	}
+	var layers []*layer
+	byDigest := make(map[string]*layer)
+	status := ""
+	for _, line := range strings.Split(strings.TrimSpace(response), "\n") {
+		var obj struct {
+			Status    string `json:"status"`
+			Digest    string `json:"digest"`
+			Completed int64  `json:"completed"`
+			Total     int64  `json:"total"`
+		}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			continue
+		}
+		if obj.Status != "" {
+			status = obj.Status
+		}
+		if obj.Digest == "" || obj.Total <= 0 {
+			continue
+		}
+		l, ok := byDigest[obj.Digest]
+		if !ok {
+			l = &layer{digest: obj.Digest}
+			byDigest[obj.Digest] = l
+			layers = append(layers, l)
+		}
+		l.completed, l.total = obj.Completed, obj.Total
+	}
+
+	var sb strings.Builder
+	if model := requestModel(request); model != "" {
+		sb.WriteString(fmt.Sprintf("[%s]Model:[%s] %s\n\n", th.Model, th.Text, tview.Escape(model)))
+	}
+	if len(layers) > 0 {
+		sb.WriteString(fmt.Sprintf("[%s]Layers:[%s]\n", th.Model, th.Text))
+	}
+	for _, l := range layers {
+		completed := min(max(l.completed, 0), l.total)
+		filled := int(int64(progressBarWidth) * completed / l.total)
+		digest := strings.TrimPrefix(l.digest, "sha256:")
+		if len(digest) > 12 {
+			digest = digest[:12]
+		}
+		sb.WriteString(fmt.Sprintf("  %-12s [%s]%s[%s]%s %3d%% %s / %s\n", digest, th.Assistant,
+			strings.Repeat("█", filled), th.Text, strings.Repeat("░", progressBarWidth-filled),
+			completed*100/l.total, formatSize(int(completed)), formatSize(int(l.total))))
+	}
+	if status != "" {
+		if len(layers) > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("[%s]Status:[%s] %s\n", th.Model, th.Text, tview.Escape(status)))
+	}
+	sb.WriteString(formatResponseError(types.ResponseError(response), opts))
+	if sb.Len() == 0 {
+		return formatRaw(request, response, opts)
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// responseParts accumulates what is shown of a single or streamed chat or generate response, one JSON
+// object per line. Lines are parsed once as they arrive, instead of parsing the whole response again on
+// every streamed chunk.
+type responseParts struct {
+	text         strings.Builder
+	reasoning    strings.Builder
+	toolCalls    []any
+	errorMessage string
+	// contextLength is the length of the context a generate response returns to continue from
+	contextLength int
+
+	// consumed is the number of bytes of the response parsed so far, always at the end of an object
+	consumed int
+}
+
+// add parses the objects appended to the response since the last call. An incomplete object at the
+// end is left for the next call.
+func (p *responseParts) add(response string) {
+	rest := response[p.consumed:]
+	for rest != "" {
+		line, after, found := strings.Cut(rest, "\n")
+		if !found && !json.Valid([]byte(line)) {
+			return
+		}
+		p.consumed += len(rest) - len(after)
+		rest = after
+		p.addObject(line)
+	}
+}
+
+// addObject adds the text, reasoning, tool calls and error of one response object, in the formats of
+// /api/generate ("response") and /api/chat ("message")
+func (p *responseParts) addObject(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	var data map[string]any
+	if err := json.Unmarshal([]byte(line), &data); err != nil {
+		return
+	}
+
+	text, _ := data["response"].(string)
+	p.text.WriteString(text)
+	p.reasoning.WriteString(messageReasoning(data))
+	if message, ok := data["message"].(map[string]any); ok {
+		content, _ := message["content"].(string)
+		p.text.WriteString(content)
+		if calls, ok := message["tool_calls"].([]any); ok {
+			p.toolCalls = append(p.toolCalls, calls...)
+		}
+		p.reasoning.WriteString(messageReasoning(message))
+	}
+	if message, ok := data["error"].(string); ok && message != "" {
+		p.errorMessage = message
+	}
+	if context, ok := data["context"].([]any); ok {
+		p.contextLength = len(context)
+	}
+}
+
+// detailCache is what was formatted and parsed for the call shown in the detail view. The request of a
+// call never changes and its response only grows, so both are reused until another call is shown or
+// the display options change.
+type detailCache struct {
+	callID  string
+	opts    formatOptions
+	request string
+	parts   *responseParts
+}
+
+// cachedDetails renders a chat or generate call from the cached request and the response parsed so far,
+// parsing only the newly streamed objects
+func (t *TUI) cachedDetails(callID, request, response string, formatRequest func(string, formatOptions) string,
+	formatResponse func(*responseParts, string, formatOptions) string) string {
+	c := &t.detailCache
+	if c.callID != callID || c.opts != t.formatOpts || c.parts.consumed > len(response) {
+		*c = detailCache{
+			callID:  callID,
+			opts:    t.formatOpts,
+			request: formatRequest(request, t.formatOpts),
+			parts:   new(responseParts),
+		}
+	}
+	c.parts.add(response)
+	return c.request + formatResponse(c.parts, response, t.formatOpts)
+}
@@ -0,0 +1,121 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResponsePartsAccumulate(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  string
+		text      string
+		reasoning string
+	}{
+		{
+			name:     "response chunks",
+			response: `{"response":"The"}` + "\n" + `{"response":" sky"}` + "\n" + `{"response":" is blue.","done":true}` + "\n",
+			text:     "The sky is blue.",
+		},
+		{
+			name:     "message chunks",
+			response: `{"message":{"content":"The"}}` + "\n" + `{"message":{"content":" sky"}}` + "\n" + `{"message":{"content":""},"done":true}` + "\n",
+			text:     "The sky",
+		},
+		{
+			name: "message then response chunks",
+			response: `{"message":{"role":"assistant","content":"The"}}` + "\n" +
+				`{"response":" sky"}` + "\n" +
+				`{"response":" is"}` + "\n" +
+				`{"message":{"content":" blue."}}` + "\n",
+			text: "The sky is blue.",
+		},
+		{
+			name: "reasoning from both formats",
+			response: `{"thinking":"First "}` + "\n" +
+				`{"message":{"content":"","thinking":"second."}}` + "\n" +
+				`{"message":{"content":"Done"},"done":true}` + "\n",
+			text:      "Done",
+			reasoning: "First second.",
+		},
+		{
+			name:     "single object without newline",
+			response: `{"response":"Hello","done":true}`,
+			text:     "Hello",
+		},
+		{
+			name:     "malformed line in between",
+			response: `{"response":"a"}` + "\n" + `not json` + "\n" + `{"response":"b"}` + "\n",
+			text:     "ab",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parts responseParts
+			parts.add(tt.response)
+			if got := parts.text.String(); got != tt.text {
+				t.Errorf("text = %q, want %q", got, tt.text)
+			}
+			if got := parts.reasoning.String(); got != tt.reasoning {
+				t.Errorf("reasoning = %q, want %q", got, tt.reasoning)
+			}
+
+			// Parsing the response as it grows, cut at every byte, gives the same result
+			var incremental responseParts
+			for i := range len(tt.response) + 1 {
+				incremental.add(tt.response[:i])
+			}
+			if got := incremental.text.String(); got != tt.text {
+				t.Errorf("text parsed while streaming = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestResponsePartsWaitForCompleteObject(t *testing.T) {
+	var parts responseParts
+	first := `{"response":"Hel"}` + "\n"
+	parts.add(first + `{"response":"l`)
+	if got := parts.text.String(); got != "Hel" {
+		t.Fatalf("text = %q before the second object is complete, want %q", got, "Hel")
+	}
+	parts.add(first + `{"response":"lo"}`)
+	if got := parts.text.String(); got != "Hello" {
+		t.Errorf("text = %q, want %q", got, "Hello")
+	}
+	if want := len(first) + len(`{"response":"lo"}`); parts.consumed != want {
+		t.Errorf("consumed = %d, want %d", parts.consumed, want)
+	}
+}
+
+// BenchmarkResponseParts compares parsing a 5000-chunk chat response for the detail view as it grows,
+// incrementally and from scratch. Progress is redrawn coalesced, here on every 50th chunk.
+func BenchmarkResponseParts(b *testing.B) {
+	const chunks, redrawEvery = 5000, 50
+	chunk := `{"model":"llama3","message":{"role":"assistant","content":" word"},"done":false}` + "\n"
+	var responses []string
+	var response strings.Builder
+	for i := range chunks {
+		response.WriteString(chunk)
+		if (i+1)%redrawEvery == 0 {
+			responses = append(responses, response.String())
+		}
+	}
+
+	b.Run("incremental", func(b *testing.B) {
+		for b.Loop() {
+			var parts responseParts
+			for _, response := range responses {
+				parts.add(response)
+			}
+		}
+	})
+	b.Run("reparse", func(b *testing.B) {
+		for b.Loop() {
+			for _, response := range responses {
+				var parts responseParts
+				parts.add(response)
+			}
+		}
+	})
+}
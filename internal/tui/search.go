@@ -0,0 +1,88 @@
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// tagPattern matches tview color, region and escaped tags, which must not be searched
+var tagPattern = regexp.MustCompile(`\[[a-zA-Z0-9_,;: \-\."#]*\[*\]`)
+
+// highlightMatches wraps every case-insensitive occurrence of query outside of tview tags
+// in a numbered region tag ("s0", "s1", ...) and returns the number of matches
+func highlightMatches(text, query string) (string, int) {
+	if query == "" {
+		return text, 0
+	}
+	pattern := regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+
+	var sb strings.Builder
+	count := 0
+	highlight := func(segment string) {
+		sb.WriteString(pattern.ReplaceAllStringFunc(segment, func(match string) string {
+			region := fmt.Sprintf(`["s%d"]%s[""]`, count, match)
+			count++
+			return region
+		}))
+	}
+
+	last := 0
+	for _, loc := range tagPattern.FindAllStringIndex(text, -1) {
+		highlight(text[last:loc[0]])
+		sb.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	highlight(text[last:])
+
+	return sb.String(), count
+}
+
+func (t *TUI) setupSearch() {
+	t.searchInput = tview.NewInputField().SetLabel("/")
+	t.searchInput.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			t.search(t.searchInput.GetText())
+		}
+		t.flex.ResizeItem(t.searchInput, 0, 0)
+		t.app.SetFocus(t.detailView)
+	})
+}
+
+// openSearch shows the search prompt below the detail view
+func (t *TUI) openSearch() {
+	t.searchInput.SetText(t.searchQuery)
+	t.flex.ResizeItem(t.searchInput, 1, 0)
+	t.app.SetFocus(t.searchInput)
+}
+
+// search highlights all matches of query in the detail view and jumps to the first one.
+// An empty query clears the highlights.
+func (t *TUI) search(query string) {
+	t.searchQuery = query
+	t.searchIndex = 0
+	t.updateDetailView()
+}
+
+// nextMatch moves the highlighted match forward or backward, wrapping around
+func (t *TUI) nextMatch(delta int) {
+	if t.searchMatches == 0 {
+		return
+	}
+	t.searchIndex = (t.searchIndex + delta + t.searchMatches) % t.searchMatches
+	t.showMatch()
+}
+
+// showMatch highlights the current match and scrolls it into view
+func (t *TUI) showMatch() {
+	t.updateDetailTitle()
+	if t.searchMatches == 0 {
+		t.detailView.Highlight()
+		return
+	}
+	t.detailView.Highlight(fmt.Sprintf("s%d", t.searchIndex))
+	t.detailView.ScrollToHighlight()
+}
@@ -0,0 +1,159 @@
+package tui
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rivo/tview"
+)
+
+// uiState is the part of the TUI state that is persisted across restarts
+type uiState struct {
+	SelectedID     string `json:"selected_id,omitempty"`
+	Focus          string `json:"focus,omitempty"`
+	OldestFirst    bool   `json:"oldest_first"`
+	RawMode        bool   `json:"raw_mode"`
+	ShowParameters bool   `json:"show_parameters"`
+	HideReasoning  bool   `json:"hide_reasoning"`
+	GroupThreads   bool   `json:"group_threads"`
+	EndpointFilter string `json:"endpoint_filter,omitempty"`
+	ErrorsOnly     bool   `json:"errors_only"`
+	ListWidth      int    `json:"list_width,omitempty"`
+	DetailScroll   int    `json:"detail_scroll"`
+	LogScroll      int    `json:"log_scroll"`
+}
+
+// uiStatePath returns the location of the state file in the user's config directory
+func uiStatePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ollama-proxy", "ui-state.json"), nil
+}
+
+func loadUIState() (uiState, error) {
+	var state uiState
+	path, err := uiStatePath()
+	if err != nil {
+		return state, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func saveUIState(state uiState) error {
+	path, err := uiStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// focusNames maps the focusable panels to the names stored in the state file
+func (t *TUI) focusNames() map[string]tview.Primitive {
+	return map[string]tview.Primitive{
+		"calls":   t.callList,
+		"details": t.detailView,
+		"log":     t.logView,
+	}
+}
+
+// captureState collects the current UI state for persistence
+func (t *TUI) captureState() uiState {
+	state := uiState{
+		SelectedID:     t.selectedID,
+		OldestFirst:    t.oldestFirst,
+		RawMode:        t.rawMode,
+		ShowParameters: t.formatOpts.showParameters,
+		HideReasoning:  t.formatOpts.hideReasoning,
+		GroupThreads:   t.groupThreads,
+		EndpointFilter: t.endpointFilter,
+		ErrorsOnly:     t.errorsOnly,
+		ListWidth:      t.listWidth,
+	}
+	state.DetailScroll, _ = t.detailView.GetScrollOffset()
+	state.LogScroll, _ = t.logView.GetScrollOffset()
+
+	focus := t.app.GetFocus()
+	for name, p := range t.focusNames() {
+		if p == focus {
+			state.Focus = name
+		}
+	}
+	return state
+}
+
+// restoreSettings applies the persisted display settings before the first render
+func (t *TUI) restoreSettings(state uiState) {
+	t.oldestFirst = state.OldestFirst
+	t.rawMode = state.RawMode
+	t.formatOpts.showParameters = state.ShowParameters
+	t.formatOpts.hideReasoning = state.HideReasoning
+	t.groupThreads = state.GroupThreads
+	t.endpointFilter = state.EndpointFilter
+	t.errorsOnly = state.ErrorsOnly
+	if state.ListWidth > 0 {
+		t.resizeList(state.ListWidth - t.listWidth)
+	}
+	t.updateListTitle()
+	t.updateDetailTitle()
+}
+
+// restorePosition applies the persisted selection, focus and scroll positions once calls are listed
+func (t *TUI) restorePosition(state uiState) {
+	if state.SelectedID != "" {
+		// Rendering the details would scroll them to the end, so the offset is left to the render
+		t.pendingDetailScroll, t.hasPendingDetailScroll = state.DetailScroll, true
+		if t.selectCall(state.SelectedID) && t.hasPendingDetailScroll {
+			// The call was already selected, so selecting it again rendered nothing
+			t.updateDetailView()
+		}
+		t.hasPendingDetailScroll = false
+	}
+	if p, ok := t.focusNames()[state.Focus]; ok {
+		t.app.SetFocus(p)
+	}
+	t.logView.ScrollTo(state.LogScroll, 0)
+}
+
+// loadState reads the persisted state if enabled, logging anything but a missing file
+func (t *TUI) loadState() (uiState, bool) {
+	if !t.saveUIState {
+		return uiState{}, false
+	}
+	state, err := loadUIState()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("WARN: Failed to load UI state: %v", err)
+		}
+		return uiState{}, false
+	}
+	return state, true
+}
+
+// saveState persists the current UI state if enabled
+func (t *TUI) saveState() {
+	if !t.saveUIState {
+		return
+	}
+	if err := saveUIState(t.captureState()); err != nil {
+		log.Printf("WARN: Failed to save UI state: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"ollama-proxy/internal/types"
+)
+
+// modelStats aggregates the calls made to one model
+type modelStats struct {
+	model            string
+	count            int
+	errors           int
+	disconnected     int
+	durations        []time.Duration
+	promptTokens     int
+	completionTokens int
+}
+
+func (s *modelStats) add(call types.CallSnapshot) {
+	s.count++
+	switch call.Status {
+	case types.StatusError:
+		s.errors++
+	case types.StatusDisconnected:
+		s.disconnected++
+	}
+	// Aborted and rejected calls are left out of the latencies, their truncated durations would skew them
+	if status := call.Status; status != types.StatusActive && status != types.StatusDisconnected && status != types.StatusRateLimited {
+		s.durations = append(s.durations, time.Duration(call.DurationMs)*time.Millisecond)
+	}
+	s.promptTokens += call.PromptTokens
+	s.completionTokens += call.CompletionTokens
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+func (s *modelStats) average() time.Duration {
+	if len(s.durations) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range s.durations {
+		total += d
+	}
+	return total / time.Duration(len(s.durations))
+}
+
+// computeStats groups calls by model, sorted by call count, followed by a total row. Each call is
+// read from one snapshot, so that its status, duration and tokens agree while it is finishing.
+func computeStats(calls []*types.Call) []*modelStats {
+	byModel := make(map[string]*modelStats)
+	total := &modelStats{model: "All models"}
+	for _, c := range calls {
+		call := c.Snapshot()
+		model := call.Model
+		if model == "" {
+			model = "(unknown)"
+		}
+		stats, ok := byModel[model]
+		if !ok {
+			stats = &modelStats{model: model}
+			byModel[model] = stats
+		}
+		stats.add(call)
+		total.add(call)
+	}
+
+	result := make([]*modelStats, 0, len(byModel)+1)
+	for _, stats := range byModel {
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count != result[j].count {
+			return result[i].count > result[j].count
+		}
+		return result[i].model < result[j].model
+	})
+	for _, stats := range append(result, total) {
+		sort.Slice(stats.durations, func(i, j int) bool { return stats.durations[i] < stats.durations[j] })
+	}
+	return append(result, total)
+}
+
+func (t *TUI) setupStats() {
+	t.statsTable = tview.NewTable().SetBorders(false).SetFixed(1, 1).SetSeparator(' ')
+	t.statsTable.SetBorder(true).SetTitle(" Statistics (S or Esc to close) ")
+	t.statsTable.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEscape,
+			event.Key() == tcell.KeyRune && event.Rune() == 'S':
+			t.toggleStats()
+			return nil
+		}
+		return event
+	})
+}
+
+// toggleStats shows or hides the statistics overlay, computing the statistics when opening
+func (t *TUI) toggleStats() {
+	if front, _ := t.pages.GetFrontPage(); front != statsPage {
+		rows := t.updateStats()
+		t.pages.AddPage(statsPage, centered(t.statsTable, 0, rows+2), true, false)
+	}
+	t.toggleOverlay(statsPage, t.statsTable)
+}
+
+// updateStats fills the statistics table and returns the number of rows
+func (t *TUI) updateStats() int {
+	t.statsTable.Clear()
+
+	headers := []string{"Model", "Calls", "Avg", "Median", "P95", "Errors", "Aborted", "Prompt", "Completion"}
+	for col, header := range headers {
+		t.statsTable.SetCell(0, col, tview.NewTableCell(header).
+			SetAttributes(tcell.AttrBold).
+			SetSelectable(false).
+			SetExpansion(1))
+	}
+
+	for i, stats := range computeStats(t.tracker.GetCalls()) {
+		errorRate := 0.0
+		if stats.count > 0 {
+			errorRate = float64(stats.errors) / float64(stats.count) * 100
+		}
+		values := []string{
+			stats.model,
+			fmt.Sprintf("%d", stats.count),
+			stats.average().Round(time.Millisecond).String(),
+			percentile(stats.durations, 0.5).Round(time.Millisecond).String(),
+			percentile(stats.durations, 0.95).Round(time.Millisecond).String(),
+			fmt.Sprintf("%d (%.0f%%)", stats.errors, errorRate),
+			fmt.Sprintf("%d", stats.disconnected),
+			fmt.Sprintf("%d", stats.promptTokens),
+			fmt.Sprintf("%d", stats.completionTokens),
+		}
+		for col, value := range values {
+			cell := tview.NewTableCell(tview.Escape(value)).SetExpansion(1)
+			if col > 0 {
+				cell.SetAlign(tview.AlignRight)
+			}
+			t.statsTable.SetCell(i+1, col, cell)
+		}
+	}
+	return t.statsTable.GetRowCount()
+}
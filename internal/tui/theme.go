@@ -0,0 +1,144 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+
+	"ollama-proxy/internal/types"
+)
+
+// Theme holds the color tags and status icons used by the TUI.
+// Colors are tview color tags without brackets, e.g. "blue" or "::b".
+type Theme struct {
+	Model     string
+	Prompt    string
+	Response  string
+	Assistant string
+	Text      string
+	Role      string
+	Tool      string
+	Reasoning string
+	Border    tcell.Color
+
+	LogError string
+	LogWarn  string
+	LogDebug string
+
+	DiffAdded   string
+	DiffRemoved string
+
+	IconActive       string
+	IconDone         string
+	IconError        string
+	IconDisconnected string
+	IconRateLimited  string
+}
+
+var themes = map[string]Theme{
+	"dark": {
+		Model:            "blue",
+		Prompt:           "olive",
+		Response:         "olive",
+		Assistant:        "-",
+		Text:             "-",
+		Role:             "red",
+		Tool:             "purple",
+		Reasoning:        "gray",
+		Border:           tcell.ColorDefault,
+		LogError:         "red",
+		LogWarn:          "yellow",
+		LogDebug:         "gray",
+		DiffAdded:        "green",
+		DiffRemoved:      "red",
+		IconActive:       "🟢",
+		IconDone:         "✅",
+		IconError:        "❌",
+		IconDisconnected: "🟠",
+		IconRateLimited:  "⏳",
+	},
+	"light": {
+		Model:            "navy",
+		Prompt:           "darkgreen",
+		Response:         "darkgreen",
+		Assistant:        "-",
+		Text:             "-",
+		Role:             "maroon",
+		Tool:             "purple",
+		Reasoning:        "gray",
+		Border:           tcell.ColorGray,
+		LogError:         "maroon",
+		LogWarn:          "olive",
+		LogDebug:         "gray",
+		DiffAdded:        "darkgreen",
+		DiffRemoved:      "maroon",
+		IconActive:       "🟢",
+		IconDone:         "✅",
+		IconError:        "❌",
+		IconDisconnected: "🟠",
+		IconRateLimited:  "⏳",
+	},
+	"mono": {
+		Model:            "::b",
+		Prompt:           "::b",
+		Response:         "::b",
+		Assistant:        "::b",
+		Text:             "::-",
+		Role:             "::u",
+		Tool:             "::b",
+		Reasoning:        "::d",
+		Border:           tcell.ColorDefault,
+		LogError:         "::b",
+		LogWarn:          "::u",
+		LogDebug:         "::d",
+		DiffAdded:        "::b",
+		DiffRemoved:      "::d",
+		IconActive:       "*",
+		IconDone:         "+",
+		IconError:        "x",
+		IconDisconnected: "-",
+		IconRateLimited:  "~",
+	},
+}
+
+// DefaultTheme is the theme used when none is configured
+const DefaultTheme = "dark"
+
+// LookupTheme returns the built-in theme with the given name
+func LookupTheme(name string) (Theme, error) {
+	theme, ok := themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q (available: %s)", name, strings.Join(ThemeNames(), ", "))
+	}
+	return theme, nil
+}
+
+// ThemeNames returns the names of all built-in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StatusIcon returns the icon representing a call status
+func (th Theme) StatusIcon(status types.CallStatus) string {
+	switch status {
+	case types.StatusActive:
+		return th.IconActive
+	case types.StatusDone:
+		return th.IconDone
+	case types.StatusError:
+		return th.IconError
+	case types.StatusDisconnected:
+		return th.IconDisconnected
+	case types.StatusRateLimited:
+		return th.IconRateLimited
+	default:
+		return " "
+	}
+}
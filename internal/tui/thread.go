@@ -0,0 +1,188 @@
+package tui
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"ollama-proxy/internal/types"
+)
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatMessages returns the messages of a chat request, or nil for any other request
+func chatMessages(request string) []chatMessage {
+	var req struct {
+		Messages []chatMessage `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(request), &req); err != nil {
+		return nil
+	}
+	return req.Messages
+}
+
+// conversation is a chat reconstructed from the calls a client made while it went on
+type conversation struct {
+	calls    []types.CallSnapshot // oldest first
+	messages []chatMessage        // the history sent by the newest call
+	last     types.CallSnapshot   // the newest call, its response is the final reply
+}
+
+// findConversation groups the calls of the thread the selected chat call belongs to, see the thread view.
+// It returns false when the selected call is not a chat call.
+func findConversation(calls []types.CallSnapshot, selected types.CallSnapshot) (conversation, bool) {
+	var conv conversation
+	thread := cmp.Or(selected.ThreadID, selected.ID)
+	for _, call := range calls {
+		if cmp.Or(call.ThreadID, call.ID) == thread {
+			conv.calls = append(conv.calls, call)
+		}
+	}
+	slices.SortFunc(conv.calls, func(a, b types.CallSnapshot) int { return a.StartTime.Compare(b.StartTime) })
+	if len(conv.calls) == 0 {
+		return conv, false
+	}
+
+	conv.last = conv.calls[len(conv.calls)-1]
+	conv.messages = chatMessages(conv.last.Request)
+	return conv, len(conv.messages) > 0
+}
+
+// formatConversation renders a conversation as markdown, one section per turn, ending with the final reply
+func formatConversation(conv conversation) string {
+	first, last := conv.calls[0], conv.calls[len(conv.calls)-1]
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Conversation with %s\n\n", conv.last.Model)
+	fmt.Fprintf(&sb, "%d calls from %s to %s:\n\n", len(conv.calls),
+		first.StartTime.Format("2006-01-02 15:04:05"), last.StartTime.Format("2006-01-02 15:04:05"))
+	for _, call := range conv.calls {
+		fmt.Fprintf(&sb, "- `%s` %s %s\n", call.ID, call.StartTime.Format("15:04:05"), call.Status)
+	}
+
+	writeTurn := func(role, content string) {
+		if role == "" {
+			role = "unknown"
+		}
+		fmt.Fprintf(&sb, "\n## %s%s\n\n%s\n", strings.ToUpper(role[:1]), role[1:], strings.TrimSpace(content))
+	}
+	for _, msg := range conv.messages {
+		writeTurn(msg.Role, msg.Content)
+	}
+
+	reply := types.ResponseText(conv.last.Response)
+	switch {
+	case conv.last.Error != "":
+		writeTurn("error", conv.last.Error)
+	case conv.last.Status == types.StatusActive:
+		writeTurn("assistant", reply+"\n\n*(still streaming)*")
+	case reply != "":
+		writeTurn("assistant", reply)
+	}
+	return sb.String()
+}
+
+// exportThread writes the conversation of the selected chat call to thread-<id>.md in the working directory
+func (t *TUI) exportThread() {
+	if t.selectedID == "" {
+		return
+	}
+	selected, ok := t.tracker.GetCall(t.selectedID)
+	if !ok {
+		return
+	}
+
+	calls := t.tracker.GetCalls()
+	snapshots := make([]types.CallSnapshot, len(calls))
+	for i, call := range calls {
+		snapshots[i] = call.Snapshot()
+	}
+	conv, ok := findConversation(snapshots, selected.Snapshot())
+	if !ok {
+		log.Printf("WARN: Call %s is not a chat call, no conversation to export", selected.ID)
+		return
+	}
+
+	path, err := filepath.Abs(fmt.Sprintf("thread-%s.md", selected.ID))
+	if err == nil {
+		err = os.WriteFile(path, []byte(formatConversation(conv)), 0o644)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to export conversation of call %s: %v", selected.ID, err)
+		return
+	}
+	log.Printf("Exported conversation of %d calls to %s", len(conv.calls), path)
+}
+
+// listRow is one entry of the call list
+type listRow struct {
+	call *types.Call
+	// marker precedes the entry for threads with several turns: their number when collapsed, or the
+	// tree of an expanded thread
+	marker string
+}
+
+// listRows lays out the calls, already in list order. When grouping by thread, a thread takes the position
+// of its first call in that order and is shown as its newest turn, or with all its turns when expanded.
+func (t *TUI) listRows(calls []*types.Call) []listRow {
+	rows := make([]listRow, 0, len(calls))
+	if !t.groupThreads {
+		for _, call := range calls {
+			rows = append(rows, listRow{call: call})
+		}
+		return rows
+	}
+
+	threads := make(map[string][]*types.Call)
+	var order []string
+	for _, call := range calls {
+		id := cmp.Or(call.ThreadID, call.ID)
+		if _, ok := threads[id]; !ok {
+			order = append(order, id)
+		}
+		threads[id] = append(threads[id], call)
+	}
+
+	for _, id := range order {
+		turns := threads[id]
+		switch {
+		case len(turns) == 1:
+			rows = append(rows, listRow{call: turns[0]})
+		case !t.expandedThreads[id]:
+			newest := slices.MaxFunc(turns, func(a, b *types.Call) int { return a.StartTime.Compare(b.StartTime) })
+			rows = append(rows, listRow{call: newest, marker: fmt.Sprintf("▸%d ", len(turns))})
+		default:
+			for i, call := range turns {
+				marker := "│ "
+				if i == 0 {
+					marker = fmt.Sprintf("▾%d ", len(turns))
+				}
+				rows = append(rows, listRow{call: call, marker: marker})
+			}
+		}
+	}
+	return rows
+}
+
+// toggleThread expands or collapses the thread of the selected call
+func (t *TUI) toggleThread() {
+	call, ok := t.tracker.GetCall(t.selectedID)
+	if !ok {
+		return
+	}
+	id := cmp.Or(call.ThreadID, call.ID)
+	if t.expandedThreads[id] {
+		delete(t.expandedThreads, id)
+	} else {
+		t.expandedThreads[id] = true
+	}
+	t.updateCallList()
+}
@@ -1,11 +1,18 @@
 package tui
 
 import (
+	"cmp"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/text/cases"
@@ -19,34 +26,138 @@ import (
 )
 
 type TUI struct {
-	app        *tview.Application
-	callList   *tview.List
-	detailView *tview.TextView
-	logView    *tview.TextView
-	statusView *tview.TextView
-	flex       *tview.Flex
+	app         *tview.Application
+	callList    *tview.List
+	detailView  *tview.TextView
+	logView     *tview.TextView
+	statusView  *tview.TextView
+	helpView    *tview.TextView
+	searchInput *tview.InputField
+	noteInput   *tview.InputField
+	flex        *tview.Flex
+	topPanel    *tview.Flex
+	pages       *tview.Pages
+	listWidth   int
+
+	saveUIState bool
+	replay      func(call *types.Call) error
+	name        string
+
+	logEntries  []logEntry
+	minLogLevel logLevel
+	maxLogLines int
+
+	searchQuery   string
+	searchIndex   int
+	searchMatches int
+
+	statsTable *tview.Table
+
+	overlayReturnFocus tview.Primitive
+
+	// followActive keeps the newest active call selected
+	followActive bool
+
+	// baselineID is the call other calls are compared to, if any
+	baselineID string
+
+	// pendingDetailScroll is the restored detail scroll offset, applied by the next detail render
+	// instead of scrolling to the end
+	pendingDetailScroll    int
+	hasPendingDetailScroll bool
+
+	// groupThreads collapses the calls of a conversation into one list entry, expandedThreads
+	// lists the threads shown with all their turns
+	groupThreads    bool
+	expandedThreads map[string]bool
+
+	// endpointFilter is the name of the endpoint filter applied to the call list, empty shows all calls
+	endpointFilter string
+
+	// errorsOnly shows only errored and disconnected calls, with their status code and error message
+	errorsOnly bool
+
+	// noteCallID is the call whose note is being edited
+	noteCallID string
+
+	// curlBase is the base URL of copied curl commands, empty for the upstream of each call
+	curlBase string
+	noCurl   bool
+	// clipboard is copied to the terminal's clipboard on the next draw
+	clipboard []byte
+
+	// upstreamUp shows whether the health probe last reached the upstream, nil until it reported
+	upstreamUp *bool
+
+	// detailCache keeps the formatted request and parsed response of the call in the detail view
+	detailCache detailCache
+
+	// paused stops live updates from being rendered, set from the UI and read by the event loop
+	paused atomic.Bool
+
+	tracker     *tracker.CallTracker
+	selectedID  string
+	rawMode     bool
+	oldestFirst bool
+	formatOpts  formatOptions
+	logChan     chan string
+	logMu       sync.RWMutex
+	logClosed   bool
+}
 
-	tracker    *tracker.CallTracker
-	selectedID string
-	logChan    chan string
-	logMu      sync.RWMutex
-	logClosed  bool
+// Options configures optional TUI behavior
+type Options struct {
+	// ListWidth is the initial width of the call list in columns
+	ListWidth int
+	// Theme selects colors and status icons; the zero value uses the default theme
+	Theme *Theme
+	// SaveUIState restores the UI state on startup and saves it on exit
+	SaveUIState bool
+	// Replay re-issues a captured call against the upstream; replaying is disabled if nil
+	Replay func(call *types.Call) error
+	// Mouse enables clicking to select calls and focus panels, and scrolling with the wheel
+	Mouse bool
+	// FollowActive starts with the newest active call selected, toggled with f
+	FollowActive bool
+	// LogLines is the number of log lines kept in the log pane; zero uses defaultLogLines
+	LogLines int
+	// Name identifies this proxy instance in the status bar and the terminal title
+	Name string
+	// CurlBase is the base URL calls copied as curl commands are sent to; empty uses the upstream of each call
+	CurlBase string
+	// NoCurl disables copying calls as curl commands, for stored requests that differ from the ones sent
+	NoCurl bool
+	// LogBuffer is the number of log lines queued for the log pane before logging blocks; zero uses defaultLogBuffer
+	LogBuffer int
+	// TimeFormat is the Go time layout of the start times in the call list and details and of the expiry of
+	// loaded models; empty uses defaultListTimeFormat in the list and defaultDetailTimeFormat in the details
+	TimeFormat string
+	// UTC shows times in UTC instead of the local time zone
+	UTC bool
 }
 
 const (
-	modelColor     = "blue"
-	promptColor    = "olive"
-	responseColor  = "olive"
-	assistantColor = "-"
-	textColor      = "-"
-	roleColor      = "red"
+	defaultListWidth = 40
+	minListWidth     = 20
+	maxListWidth     = 200
+	listWidthStep    = 4
+	defaultLogLines  = 1000
+	defaultLogBuffer = 1000
+
+	defaultListTimeFormat   = "15:04:05"
+	defaultDetailTimeFormat = "2006-01-02 15:04:05.000 MST"
 )
 
-func NewTUI(tracker *tracker.CallTracker) *TUI {
-	app := tview.NewApplication()
+func NewTUI(tracker *tracker.CallTracker, opts Options) *TUI {
+	app := tview.NewApplication().EnableMouse(opts.Mouse)
+
+	theme := themes[DefaultTheme]
+	if opts.Theme != nil {
+		theme = *opts.Theme
+	}
 
 	// Use default terminal colors
-	tview.Styles = tview.Theme{}
+	tview.Styles = tview.Theme{BorderColor: theme.Border, TitleColor: theme.Border}
 
 	logView := tview.NewTextView().
 		SetDynamicColors(true).
@@ -54,15 +165,48 @@ func NewTUI(tracker *tracker.CallTracker) *TUI {
 		SetWrap(true).
 		SetChangedFunc(func() { app.Draw() })
 
+	logBuffer := opts.LogBuffer
+	if logBuffer <= 0 {
+		logBuffer = defaultLogBuffer
+	}
+
 	t := &TUI{
 		app:        app,
 		callList:   tview.NewList().ShowSecondaryText(false).SetSelectedStyle(tcell.Style{}.Reverse(true)),
 		detailView: tview.NewTextView().SetDynamicColors(true),
 		logView:    logView,
-		statusView: tview.NewTextView().SetTextAlign(tview.AlignCenter),
+		statusView: tview.NewTextView().SetTextAlign(tview.AlignCenter).SetDynamicColors(true),
 		tracker:    tracker,
-		logChan:    make(chan string, 1000), // Buffered channel to prevent blocking
+		logChan:    make(chan string, logBuffer), // Buffered channel to prevent blocking
+		listWidth:  opts.ListWidth,
+		formatOpts: formatOptions{
+			theme:            theme,
+			location:         time.Local,
+			listTimeFormat:   cmp.Or(opts.TimeFormat, defaultListTimeFormat),
+			detailTimeFormat: cmp.Or(opts.TimeFormat, defaultDetailTimeFormat),
+		},
+
+		saveUIState:  opts.SaveUIState,
+		replay:       opts.Replay,
+		followActive: opts.FollowActive,
+		maxLogLines:  opts.LogLines,
+		name:         opts.Name,
+		curlBase:     opts.CurlBase,
+		noCurl:       opts.NoCurl,
+
+		expandedThreads: make(map[string]bool),
+	}
+	if t.listWidth <= 0 {
+		t.listWidth = defaultListWidth
+	}
+	if opts.UTC {
+		t.formatOpts.location = time.UTC
 	}
+	if t.maxLogLines <= 0 {
+		t.maxLogLines = defaultLogLines
+	}
+	logView.SetMaxLines(t.maxLogLines)
+	t.listWidth = min(max(t.listWidth, minListWidth), maxListWidth)
 
 	t.setupUI()
 	return t
@@ -70,7 +214,8 @@ func NewTUI(tracker *tracker.CallTracker) *TUI {
 
 func (t *TUI) setupUI() {
 	// Configure call list
-	t.callList.SetBorder(true).SetTitle(" API Calls ")
+	t.callList.SetBorder(true)
+	t.updateListTitle()
 	t.callList.SetWrapAround(false)
 
 	// Handle selection changes (both arrow keys and Enter)
@@ -96,8 +241,26 @@ func (t *TUI) setupUI() {
 		handleSelection(index)
 	})
 
+	t.callList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Moving the selection by hand ends follow mode, which would otherwise take it back on the next event
+		if t.followActive && isListNavigation(event) {
+			t.followActive = false
+			t.updateListTitle()
+		}
+		if t.groupThreads && event.Key() == tcell.KeyEnter {
+			t.toggleThread()
+			return nil
+		}
+		if event.Key() == tcell.KeyRune && event.Rune() == 'n' {
+			t.openNote()
+			return nil
+		}
+		return listVimKeys(t.callList, event)
+	})
+
 	// Configure log view
-	t.logView.SetBorder(true).SetTitle(" Log ")
+	t.logView.SetBorder(true)
+	t.updateLogTitle()
 	t.logView.SetScrollable(true).SetWrap(false)
 	t.logView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		// Allow scrolling in log view
@@ -106,40 +269,73 @@ func (t *TUI) setupUI() {
 			t.app.SetFocus(t.callList)
 			return nil
 		}
-		return event
+		return textViewVimKeys(t.logView, event)
 	})
 
 	// Configure detail view
-	t.detailView.SetBorder(true).SetTitle(" Details ")
+	t.detailView.SetBorder(true)
+	t.updateDetailTitle()
 	t.detailView.SetScrollable(true).SetWrap(true)
 	t.detailView.SetChangedFunc(func() {
 		t.app.Draw()
 	})
+	t.detailView.SetRegions(true)
+	t.detailView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRune {
+			switch event.Rune() {
+			case '/':
+				t.openSearch()
+				return nil
+			case 'n':
+				t.nextMatch(1)
+				return nil
+			case 'N':
+				t.nextMatch(-1)
+				return nil
+			}
+		}
+		return textViewVimKeys(t.detailView, event)
+	})
+	t.setupSearch()
+	t.setupNote()
 
 	// Configure status view
 	t.statusView.SetBorder(false)
-	t.statusView.SetText("↑/↓: Navigate | Enter: Select | Tab/Shift+Tab: Switch Panel | Esc: Back to Calls | q: Quit")
+	t.updateStatus()
 
 	// Create the layout
 	// Top panel contains call list and detail view side by side
-	topPanel := tview.NewFlex()
-	// Set fixed width of 30 columns for the call list, then let detail view take remaining space
-	topPanel.AddItem(t.callList, 40, 0, true)
-	topPanel.AddItem(t.detailView, 0, 1, false)
+	t.topPanel = tview.NewFlex()
+	// Set fixed width for the call list, then let detail view take remaining space
+	t.topPanel.AddItem(t.callList, t.listWidth, 0, true)
+	t.topPanel.AddItem(t.detailView, 0, 1, false)
 
 	// Main layout: top panel on top, log view at bottom
 	t.flex = tview.NewFlex().
 		SetDirection(tview.FlexRow).
-		AddItem(topPanel, 0, 1, true).
-		AddItem(t.logView, 10, 1, false). // Fixed height for log view
-		AddItem(t.statusView, 1, 0, false)
+		AddItem(t.topPanel, 0, 1, true).
+		AddItem(t.searchInput, 0, 0, false). // Hidden until a search is started
+		AddItem(t.noteInput, 0, 0, false).   // Hidden until a note is edited
+		AddItem(t.logView, 10, 1, false).    // Fixed height for log view
+		AddItem(t.statusView, 2, 0, false)
+
+	// Pages allow overlays such as the help screen to be drawn on top of the main layout
+	t.pages = tview.NewPages().AddPage(mainPage, t.flex, true, true)
+	t.setupHelp()
+	t.setupStats()
 
 	// Setup logger with our custom writer that updates the UI
 	log.SetOutput(&logWriter{tui: t})
-	log.Printf("Colors: [%s]modelColor, [%s]promptColor, [%s]responseColor, [%s]assistantColor, [%s]headerColor [-]", modelColor, promptColor, responseColor, assistantColor, roleColor)
+	th := t.formatOpts.theme
+	log.Printf("DEBUG: Colors: [%s]modelColor, [%s]promptColor, [%s]responseColor, [%s]assistantColor, [%s]headerColor [-:-:-]", th.Model, th.Prompt, th.Response, th.Assistant, th.Role)
 
 	// Set input capture for global shortcuts
 	t.flex.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Leave all keys to input fields while typing
+		if _, ok := t.app.GetFocus().(*tview.InputField); ok {
+			return event
+		}
+
 		switch event.Key() {
 		case tcell.KeyTab:
 			// Cycle focus between call list, detail view, and log view
@@ -172,7 +368,82 @@ func (t *TUI) setupUI() {
 		case tcell.KeyRune:
 			switch event.Rune() {
 			case 'q':
-				t.app.Stop()
+				t.quit()
+				return nil
+			case '?':
+				t.toggleHelp()
+				return nil
+			case 'p':
+				t.formatOpts.showParameters = !t.formatOpts.showParameters
+				t.updateDetailView()
+				return nil
+			case 'L':
+				t.cycleLogLevel()
+				return nil
+			case 'x':
+				t.replaySelected()
+				return nil
+			case 'y':
+				t.copyAsCurl()
+				return nil
+			case 'v':
+				t.openInEditor()
+				return nil
+			case 'C':
+				t.finishSelected(false)
+				return nil
+			case 'E':
+				t.finishSelected(true)
+				return nil
+			case 't':
+				t.exportThread()
+				return nil
+			case 'e':
+				t.cycleEndpointFilter()
+				return nil
+			case '!':
+				t.errorsOnly = !t.errorsOnly
+				t.updateListTitle()
+				t.updateCallList()
+				return nil
+			case 'c':
+				t.groupThreads = !t.groupThreads
+				t.updateListTitle()
+				t.updateCallList()
+				return nil
+			case 'S':
+				t.toggleStats()
+				return nil
+			case 'f':
+				t.followActive = !t.followActive
+				t.updateListTitle()
+				t.updateCallList()
+				return nil
+			case 'o':
+				t.oldestFirst = !t.oldestFirst
+				t.updateListTitle()
+				t.updateCallList()
+				return nil
+			case '<':
+				t.resizeList(-listWidthStep)
+				return nil
+			case '>':
+				t.resizeList(listWidthStep)
+				return nil
+			case 'T':
+				t.formatOpts.hideReasoning = !t.formatOpts.hideReasoning
+				t.updateDetailView()
+				return nil
+			case 'b':
+				t.toggleBaseline()
+				return nil
+			case ' ':
+				t.togglePause()
+				return nil
+			case 'r':
+				t.rawMode = !t.rawMode
+				t.updateDetailTitle()
+				t.updateDetailView()
 				return nil
 			}
 		}
@@ -180,10 +451,200 @@ func (t *TUI) setupUI() {
 	})
 }
 
+// resizeList changes the width of the call list by delta columns
+func (t *TUI) resizeList(delta int) {
+	t.listWidth = min(max(t.listWidth+delta, minListWidth), maxListWidth)
+	t.topPanel.ResizeItem(t.callList, t.listWidth, 0)
+}
+
+const statusHints = "↑/↓: Navigate | Enter: Select | Tab/Shift+Tab: Switch Panel | Esc: Back to Calls | ?: Help | q: Quit"
+
+// updateStatus refreshes the session summary and keybinding hints in the status bar
+func (t *TUI) updateStatus() {
+	summary := t.tracker.Summary()
+	paused := ""
+	if t.paused.Load() {
+		paused = fmt.Sprintf("[%s]PAUSED (space to resume)[%s] | ", t.formatOpts.theme.LogWarn, t.formatOpts.theme.Text)
+	}
+	upstream := ""
+	switch {
+	case t.upstreamUp == nil:
+	case *t.upstreamUp:
+		upstream = " | Upstream: up"
+	default:
+		upstream = fmt.Sprintf(" | [%s]Upstream: down[%s]", t.formatOpts.theme.LogError, t.formatOpts.theme.Text)
+	}
+	instance := ""
+	if t.name != "" {
+		instance = fmt.Sprintf("[::b]%s[::-] | ", tview.Escape(t.name))
+	}
+	t.statusView.SetText(fmt.Sprintf("%s%sActive: %d | Calls: %d | Errors: %d | Aborted: %d | Tokens: %d | Transferred: %s%s\n%s",
+		instance, paused, summary.Active, summary.Total, summary.Errors, summary.Disconnected, summary.GeneratedTokens,
+		formatSize(summary.TransferredBytes), upstream, statusHints))
+}
+
+// SetUpstreamUp shows in the status bar whether the upstream is reachable. It is safe to call from any goroutine.
+func (t *TUI) SetUpstreamUp(up bool) {
+	t.app.QueueUpdateDraw(func() {
+		t.upstreamUp = &up
+		t.updateStatus()
+	})
+}
+
+// togglePause stops or resumes rendering live updates. Calls are still tracked while paused
+// and the UI catches up on resume.
+func (t *TUI) togglePause() {
+	paused := !t.paused.Load()
+	t.paused.Store(paused)
+	if !paused {
+		t.catchUp()
+	}
+	t.updateStatus()
+}
+
+// catchUp redraws the list and details with the updates skipped while live updates were paused
+func (t *TUI) catchUp() {
+	t.updateCallList()
+	t.updateDetailView()
+	if front, _ := t.pages.GetFrontPage(); front == statsPage {
+		t.updateStats()
+	}
+	t.updateStatus()
+}
+
+// quit stops the application, asking for confirmation first while calls are still in progress
+func (t *TUI) quit() {
+	active := t.tracker.Summary().Active
+	if active == 0 {
+		t.app.Stop()
+		return
+	}
+
+	returnFocus := t.app.GetFocus()
+	cancel := func() {
+		t.pages.RemovePage(quitPage)
+		t.app.SetFocus(returnFocus)
+	}
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("%d active calls in progress.\nQuit anyway? (y/N)", active)).
+		AddButtons([]string{"Cancel", "Quit"}).
+		SetDoneFunc(func(_ int, label string) {
+			if label == "Quit" {
+				t.app.Stop()
+				return
+			}
+			cancel()
+		})
+	modal.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() != tcell.KeyRune {
+			return event
+		}
+		switch event.Rune() {
+		case 'q', 'y':
+			t.app.Stop()
+		case 'n':
+			cancel()
+		}
+		return nil
+	})
+	t.pages.AddPage(quitPage, modal, false, true)
+	t.app.SetFocus(modal)
+}
+
+// replaySelected re-issues the selected call against the upstream
+func (t *TUI) replaySelected() {
+	if t.replay == nil || t.selectedID == "" {
+		return
+	}
+	call, ok := t.tracker.GetCall(t.selectedID)
+	if !ok {
+		return
+	}
+	if err := t.replay(call); err != nil {
+		log.Printf("ERROR: Failed to replay call %s: %v", call.ID, err)
+		return
+	}
+	log.Printf("Replaying call %s", call.ID)
+}
+
+// finishSelected marks the selected call as done, or as failed, when it is stuck as active, e.g. because
+// the end of its response was not recognized, and aborts its upstream request
+func (t *TUI) finishSelected(failed bool) {
+	if t.selectedID == "" {
+		return
+	}
+	if !t.tracker.FinishCall(t.selectedID, failed) {
+		log.Printf("WARN: Call %s is not active, nothing to finish", t.selectedID)
+		return
+	}
+	status := "done"
+	if failed {
+		status = "failed"
+	}
+	log.Printf("WARN: Marked call %s as %s by hand", t.selectedID, status)
+}
+
+// selectCall selects the call with the given ID in the list, if present
+func (t *TUI) selectCall(id string) bool {
+	for i := 0; i < t.callList.GetItemCount(); i++ {
+		if _, secondary := t.callList.GetItemText(i); secondary == id {
+			t.callList.SetCurrentItem(i)
+			return true
+		}
+	}
+	return false
+}
+
+// updateListTitle shows the current sort order and follow mode in the call list title
+func (t *TUI) updateListTitle() {
+	order := "newest first"
+	if t.oldestFirst {
+		order = "oldest first"
+	}
+	if t.endpointFilter != "" {
+		order += ", " + t.endpointFilter + " only"
+	}
+	if t.errorsOnly {
+		order += ", errors only"
+	}
+	if t.groupThreads {
+		order += ", by thread"
+	}
+	if t.followActive {
+		order += ", following"
+	}
+	t.callList.SetTitle(fmt.Sprintf(" API Calls (%s) ", order))
+}
+
+// shortIDLength returns how many characters of the call IDs the list shows: 8, or as many as it takes to
+// tell the calls apart, as git does for abbreviated hashes
+func shortIDLength(calls []*types.Call) int {
+	ids := make([]string, len(calls))
+	for i, call := range calls {
+		ids[i] = call.ID
+	}
+	slices.Sort(ids)
+
+	length := 8
+	for i := 1; i < len(ids); i++ {
+		a, b := ids[i-1], ids[i]
+		common := 0
+		for common < len(a) && common < len(b) && a[common] == b[common] {
+			common++
+		}
+		length = max(length, common+1)
+	}
+	return length
+}
+
 func (t *TUI) updateCallList() {
 	currentID := t.selectedID
 	currentIdx := t.callList.GetCurrentItem()
+	// Keep following the latest call if it is selected; its position depends on the sort order
 	followLatest := currentIdx <= 0
+	if t.oldestFirst {
+		followLatest = currentIdx < 0 || currentIdx >= t.callList.GetItemCount()-1
+	}
 	if currentIdx >= 0 && currentIdx < t.callList.GetItemCount() {
 		if _, secondary := t.callList.GetItemText(currentIdx); secondary != "" {
 			currentID = secondary
@@ -192,49 +653,68 @@ func (t *TUI) updateCallList() {
 
 	t.callList.Clear()
 
-	calls := t.tracker.GetCalls()
+	calls := t.filterCalls(t.tracker.GetCalls())
 	if len(calls) == 0 {
 		t.selectedID = ""
 		t.detailView.Clear()
 		return
 	}
+	if t.oldestFirst {
+		slices.Reverse(calls)
+	}
+	rows := t.listRows(calls)
+	idLength := shortIDLength(calls)
 
 	selectedIdx := 0
 	matchFound := false
-	for i, call := range calls {
-		status := " "
-		switch call.Status {
-		case types.StatusActive:
-			status = "🟢"
-		case types.StatusDone:
-			status = "✅"
-		case types.StatusError:
-			status = "❌"
-		case types.StatusDisconnected:
-			status = "🟠"
-		}
+	activeIdx := -1
+	for i, row := range rows {
+		call := row.call
+		callStatus := call.CurrentStatus()
+		status := t.formatOpts.theme.StatusIcon(callStatus)
 
-		duration := time.Since(call.StartTime).Round(time.Millisecond)
-		if call.Status != types.StatusActive && call.EndTime != nil {
-			duration = call.EndTime.Sub(call.StartTime).Round(time.Millisecond)
-		}
+		duration := call.Duration().Round(time.Millisecond)
 
 		shortID := call.ID
-		if len(shortID) > 8 {
-			shortID = shortID[:8]
+		if len(shortID) > idLength {
+			shortID = shortID[:idLength]
 		}
 
-		itemText := fmt.Sprintf("[%s[] %s %s %s %s", shortID, status, call.Method, call.Endpoint, duration)
+		if t.errorsOnly {
+			// The failure goes first so that it is not cut off in the narrow list
+			status += formatFailure(call)
+		}
+		started := tview.Escape(t.formatOpts.formatTime(call.StartTime, t.formatOpts.listTimeFormat))
+		itemText := fmt.Sprintf("%s[%s[] %s %s %s %s %s", row.marker, shortID, status, started, tview.Escape(call.Method), tview.Escape(call.Endpoint), duration)
 		t.callList.AddItem(itemText, call.ID, 0, nil)
 
 		if !matchFound && currentID != "" && call.ID == currentID {
 			selectedIdx = i
 			matchFound = true
 		}
+		if callStatus == types.StatusActive && (activeIdx < 0 || call.StartTime.After(rows[activeIdx].call.StartTime)) {
+			activeIdx = i
+		}
+	}
+	if !matchFound && t.groupThreads {
+		// The selected call may be a turn of a thread that was collapsed
+		if current, ok := t.tracker.GetCall(currentID); ok {
+			selectedIdx = slices.IndexFunc(rows, func(row listRow) bool { return row.call.ThreadID == current.ThreadID })
+			matchFound = selectedIdx >= 0
+			selectedIdx = max(selectedIdx, 0)
+		}
 	}
 
-	if followLatest || !matchFound {
+	switch {
+	case t.followActive && activeIdx >= 0:
+		selectedIdx = activeIdx
+	case t.followActive && matchFound:
+		// Stay on the last followed call until the next one starts
+	case followLatest || !matchFound:
 		selectedIdx = 0
+		if t.oldestFirst {
+			selectedIdx = len(rows) - 1
+		}
 	}
 
 	t.callList.SetCurrentItem(selectedIdx)
@@ -242,13 +722,263 @@ func (t *TUI) updateCallList() {
 	if _, secondary := t.callList.GetItemText(selectedIdx); secondary != "" {
 		t.selectedID = secondary
 	} else {
-		t.selectedID = calls[selectedIdx].ID
+		t.selectedID = rows[selectedIdx].call.ID
 	}
 
 	t.updateDetailView()
 }
 
-func formatGenerateMessages(request, response string) string {
+// formatOptions controls optional sections of the formatted detail view
+type formatOptions struct {
+	theme          Theme
+	showParameters bool
+	hideReasoning  bool
+
+	// location is the time zone times are shown in, formatted with the layouts of the list and the details
+	location         *time.Location
+	listTimeFormat   string
+	detailTimeFormat string
+}
+
+// formatTime renders a time in the configured time zone
+func (o formatOptions) formatTime(ts time.Time, layout string) string {
+	return ts.In(o.location).Format(layout)
+}
+
+// contentKeys are request fields rendered by the formatters themselves rather than as parameters
+var contentKeys = map[string]bool{
+	"model":    true,
+	"prompt":   true,
+	"messages": true,
+	"system":   true,
+	"template": true,
+	"suffix":   true,
+	"images":   true,
+	"context":  true,
+	"tools":    true,
+	"options":  true,
+}
+
+// formatParameters renders the sampling parameters of a request. Ollama nests them in
+// "options", while OpenAI-style requests carry them at the top level.
+func formatParameters(reqData map[string]any, opts formatOptions) string {
+	th := opts.theme
+	params := make(map[string]any)
+	for key, value := range reqData {
+		if !contentKeys[key] {
+			params[key] = value
+		}
+	}
+	if options, ok := reqData["options"].(map[string]any); ok {
+		for key, value := range options {
+			params[key] = value
+		}
+	}
+	if len(params) == 0 {
+		return ""
+	}
+
+	if !opts.showParameters {
+		return fmt.Sprintf("[%s]▶ Parameters (%d, p to expand)[%s]\n\n", th.Model, len(params), th.Text)
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s]▼ Parameters:[%s]\n", th.Model, th.Text))
+	for _, key := range keys {
+		value, err := json.Marshal(params[key])
+		if err != nil {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("  %s: %s\n", key, tview.Escape(string(value))))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// messageContent returns the text of a chat message with images replaced by placeholders.
+// Ollama attaches images as a base64 "images" array, OpenAI-style requests use content parts.
+func messageContent(msg map[string]any) string {
+	var sb strings.Builder
+	switch content := msg["content"].(type) {
+	case string:
+		sb.WriteString(tview.Escape(content))
+	case []any:
+		for _, part := range content {
+			partMap, _ := part.(map[string]any)
+			switch partMap["type"] {
+			case "text":
+				text, _ := partMap["text"].(string)
+				sb.WriteString(tview.Escape(text))
+			case "image_url":
+				imageURL, _ := partMap["image_url"].(map[string]any)
+				url, _ := imageURL["url"].(string)
+				if sb.Len() > 0 {
+					sb.WriteString("\n")
+				}
+				sb.WriteString(imagePlaceholder(url))
+			}
+		}
+	}
+
+	if images, ok := msg["images"].([]any); ok && len(images) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(strings.TrimSuffix(formatImages(images), "\n"))
+	}
+	return sb.String()
+}
+
+// formatImages renders one placeholder line per base64 encoded image
+func formatImages(images []any) string {
+	var sb strings.Builder
+	for _, image := range images {
+		if data, ok := image.(string); ok {
+			sb.WriteString(imagePlaceholder(data))
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// imagePlaceholder describes a base64 encoded image (optionally as a data URL)
+// by its decoded size and sniffed content type instead of dumping the data
+func imagePlaceholder(data string) string {
+	if _, encoded, ok := strings.Cut(data, ";base64,"); ok && strings.HasPrefix(data, "data:") {
+		data = encoded
+	} else if strings.HasPrefix(data, "http://") || strings.HasPrefix(data, "https://") {
+		return tview.Escape(fmt.Sprintf("[image: %s]", data))
+	}
+
+	size := base64.StdEncoding.DecodedLen(len(data)) - strings.Count(data[max(0, len(data)-2):], "=")
+
+	// Only the first bytes are needed to sniff the content type
+	head := data[:min(len(data), 684)]
+	head = head[:len(head)/4*4]
+	contentType := "unknown"
+	if decoded, err := base64.StdEncoding.DecodeString(head); err == nil {
+		contentType = http.DetectContentType(decoded)
+	}
+
+	return tview.Escape(fmt.Sprintf("[image: %s, %s]", formatSize(size), contentType))
+}
+
+// formatSize renders a byte count in human readable form
+func formatSize(bytes int) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%d KB", bytes>>10)
+	default:
+		return fmt.Sprintf("%d B", bytes)
+	}
+}
+
+// formatTools renders the tools offered to the model in a chat request
+func formatTools(reqData map[string]any, opts formatOptions) string {
+	th := opts.theme
+	tools, ok := reqData["tools"].([]any)
+	if !ok || len(tools) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s]Tools:[%s]\n", th.Tool, th.Text))
+	for _, tool := range tools {
+		toolMap, _ := tool.(map[string]any)
+		function, _ := toolMap["function"].(map[string]any)
+		name, _ := function["name"].(string)
+		if name == "" {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("  %s", tview.Escape(name)))
+		if description, ok := function["description"].(string); ok && description != "" {
+			sb.WriteString(fmt.Sprintf(" - %s", tview.Escape(description)))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// formatToolCalls renders function calls requested by the model.
+// Ollama sends arguments as an object, OpenAI-style APIs as a JSON string.
+func formatToolCalls(toolCalls []any, opts formatOptions) string {
+	th := opts.theme
+	var sb strings.Builder
+	for _, call := range toolCalls {
+		callMap, _ := call.(map[string]any)
+		function, _ := callMap["function"].(map[string]any)
+		name, _ := function["name"].(string)
+		if name == "" {
+			continue
+		}
+
+		var arguments string
+		switch args := function["arguments"].(type) {
+		case string:
+			arguments = args
+		case nil:
+		default:
+			if encoded, err := json.Marshal(args); err == nil {
+				arguments = string(encoded)
+			}
+		}
+		sb.WriteString(fmt.Sprintf("[%s]→ %s[%s](%s)\n", th.Tool, tview.Escape(name), th.Text, tview.Escape(arguments)))
+	}
+	return sb.String()
+}
+
+// messageReasoning returns the reasoning chunk of a response object. Ollama uses "thinking",
+// OpenAI-compatible servers "reasoning_content".
+func messageReasoning(data map[string]any) string {
+	if thinking, ok := data["thinking"].(string); ok && thinking != "" {
+		return thinking
+	}
+	reasoning, _ := data["reasoning_content"].(string)
+	return reasoning
+}
+
+// formatReasoning renders the model's reasoning in a dimmed section, collapsed if requested
+func formatReasoning(reasoning string, opts formatOptions) string {
+	th := opts.theme
+	reasoning = strings.TrimSpace(reasoning)
+	if reasoning == "" {
+		return ""
+	}
+	if opts.hideReasoning {
+		return fmt.Sprintf("\n[%s]▶ Reasoning (%d chars, T to expand)[%s]\n", th.Reasoning, len(reasoning), th.Text)
+	}
+	return fmt.Sprintf("\n[%s]▼ Reasoning:\n%s[%s]\n", th.Reasoning, tview.Escape(reasoning), th.Text)
+}
+
+// formatResponseError renders the error Ollama responded with, if any
+func formatResponseError(message string, opts formatOptions) string {
+	if message == "" {
+		return ""
+	}
+	th := opts.theme
+	return fmt.Sprintf("\n[%s]Error:[%s] %s\n", th.LogError, th.Text, tview.Escape(message))
+}
+
+func formatGenerateMessages(request, response string, opts formatOptions) string {
+	var parts responseParts
+	parts.add(response)
+	return formatGenerateRequest(request, opts) + formatGenerateResponse(&parts, response, opts)
+}
+
+// formatGenerateRequest renders the model, parameters and prompt of a generate request
+func formatGenerateRequest(request string, opts formatOptions) string {
+	th := opts.theme
 	var sb strings.Builder
 
 	// Parse the request JSON once
@@ -257,62 +987,68 @@ func formatGenerateMessages(request, response string) string {
 		if err := json.Unmarshal([]byte(request), &reqData); err == nil {
 			// Display model if available
 			if model, ok := reqData["model"].(string); ok && model != "" {
-				sb.WriteString(fmt.Sprintf("[%s]Model:[%s] %s\n\n", modelColor, textColor, model))
+				sb.WriteString(fmt.Sprintf("[%s]Model:[%s] %s\n\n", th.Model, th.Text, tview.Escape(model)))
+			}
+			sb.WriteString(formatParameters(reqData, opts))
+			if context, ok := reqData["context"].([]any); ok && len(context) > 0 {
+				sb.WriteString(fmt.Sprintf("[%s]Context:[%s] continuing from %d-token context\n\n", th.Model, th.Text, len(context)))
 			}
 
 			// Display prompt
-			sb.WriteString(fmt.Sprintf("[%s]Prompt:[%s]\n", promptColor, textColor))
+			sb.WriteString(fmt.Sprintf("[%s]Prompt:[%s]\n", th.Prompt, th.Text))
 			if prompt, ok := reqData["prompt"].(string); ok && prompt != "" {
-				sb.WriteString(prompt)
+				sb.WriteString(tview.Escape(prompt))
 				sb.WriteString("\n")
+				if images, ok := reqData["images"].([]any); ok {
+					sb.WriteString(formatImages(images))
+				}
 			} else {
-				sb.WriteString(request)
+				sb.WriteString(tview.Escape(request))
 			}
 		} else {
-			sb.WriteString(fmt.Sprintf("[%s]Prompt:[%s]\n", promptColor, textColor))
-			sb.WriteString(request)
+			sb.WriteString(fmt.Sprintf("[%s]Prompt:[%s]\n", th.Prompt, th.Text))
+			sb.WriteString(tview.Escape(request))
 		}
 	} else {
-		sb.WriteString(fmt.Sprintf("[%s]Prompt:[%s]\n", promptColor, textColor))
-		sb.WriteString(request)
+		sb.WriteString(fmt.Sprintf("[%s]Prompt:[%s]\n", th.Prompt, th.Text))
+		sb.WriteString(tview.Escape(request))
 	}
 
-	// Parse and display the response
-	sb.WriteString(fmt.Sprintf("\n\n[%s]Response:[%s]\n", responseColor, textColor))
-	if strings.TrimSpace(response) != "" {
-		// Handle both single response and streamed responses (one JSON object per line)
-		lines := strings.Split(strings.TrimSpace(response), "\n")
-		var responseBuilder strings.Builder
-
-		for _, line := range lines {
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
-
-			var respData map[string]any
-			if err := json.Unmarshal([]byte(line), &respData); err != nil {
-				continue
-			}
+	return sb.String()
+}
 
-			// Handle the response format for /api/generate
-			if chunk, ok := respData["response"].(string); ok && chunk != "" {
-				responseBuilder.WriteString(chunk)
-			}
-		}
+// formatGenerateResponse renders the response of a generate call from its parsed parts
+func formatGenerateResponse(parts *responseParts, response string, opts formatOptions) string {
+	th := opts.theme
+	var sb strings.Builder
 
-		fullResponse := responseBuilder.String()
-		if fullResponse != "" {
-			sb.WriteString(fullResponse)
+	sb.WriteString(fmt.Sprintf("\n\n[%s]Response:[%s]\n", th.Response, th.Text))
+	if strings.TrimSpace(response) != "" {
+		sb.WriteString(formatReasoning(parts.reasoning.String(), opts))
+		if fullResponse := parts.text.String(); fullResponse != "" {
+			sb.WriteString(tview.Escape(fullResponse))
 			sb.WriteString("\n")
-		} else {
-			sb.WriteString(response)
+		} else if parts.errorMessage == "" {
+			sb.WriteString(tview.Escape(response))
+		}
+		sb.WriteString(formatResponseError(parts.errorMessage, opts))
+		if parts.contextLength > 0 {
+			sb.WriteString(fmt.Sprintf("\n[%s]Context:[%s] returned %d tokens to continue from\n", th.Model, th.Text, parts.contextLength))
 		}
 	}
 
 	return sb.String()
 }
 
-func formatChatMessages(request, response string) string {
+func formatChatMessages(request, response string, opts formatOptions) string {
+	var parts responseParts
+	parts.add(response)
+	return formatChatRequest(request, opts) + formatChatResponse(&parts, response, opts)
+}
+
+// formatChatRequest renders the model, parameters, tools and messages of a chat request
+func formatChatRequest(request string, opts formatOptions) string {
+	th := opts.theme
 	var sb strings.Builder
 
 	// Parse the request JSON once
@@ -321,73 +1057,404 @@ func formatChatMessages(request, response string) string {
 		if err := json.Unmarshal([]byte(request), &reqData); err == nil {
 			// Display model if available
 			if model, ok := reqData["model"].(string); ok && model != "" {
-				sb.WriteString(fmt.Sprintf("[%s]Model:[%s] %s\n\n", modelColor, textColor, model))
+				sb.WriteString(fmt.Sprintf("[%s]Model:[%s] %s\n\n", th.Model, th.Text, tview.Escape(model)))
 			}
+			sb.WriteString(formatParameters(reqData, opts))
+			sb.WriteString(formatTools(reqData, opts))
 
 			// Display messages
-			sb.WriteString(fmt.Sprintf("[%s]Request:[%s]\n", promptColor, textColor))
+			sb.WriteString(fmt.Sprintf("[%s]Request:[%s]\n", th.Prompt, th.Text))
 			if messages, ok := reqData["messages"].([]interface{}); ok {
 				for _, msg := range messages {
 					if msgMap, ok := msg.(map[string]interface{}); ok {
 						role, _ := msgMap["role"].(string)
-						content, _ := msgMap["content"].(string)
-						if role != "" && content != "" {
-							sb.WriteString(fmt.Sprintf("\n[%s]# %s[%s]\n%s\n", roleColor, cases.Title(language.English).String(role), textColor, content))
+						content := messageContent(msgMap)
+						toolCalls, _ := msgMap["tool_calls"].([]any)
+						if role != "" && (content != "" || len(toolCalls) > 0) {
+							title := cases.Title(language.English).String(role)
+							if toolName, ok := msgMap["tool_name"].(string); ok && toolName != "" {
+								title = fmt.Sprintf("%s (%s)", title, toolName)
+							}
+							sb.WriteString(fmt.Sprintf("\n[%s]# %s[%s]\n", th.Role, tview.Escape(title), th.Text))
+							if content != "" {
+								sb.WriteString(content)
+								sb.WriteString("\n")
+							}
+							sb.WriteString(formatToolCalls(toolCalls, opts))
 						}
 					}
 				}
 			} else {
-				sb.WriteString(request)
+				sb.WriteString(tview.Escape(request))
 			}
 		} else {
-			sb.WriteString(request)
+			sb.WriteString(tview.Escape(request))
 		}
 	}
 
-	// Add response
-	sb.WriteString(fmt.Sprintf("\n\n[%s]Response:[%s]\n", responseColor, textColor))
-	if strings.TrimSpace(response) != "" {
-		// Handle both single response and streamed responses (one JSON object per line)
-		lines := strings.Split(strings.TrimSpace(response), "\n")
-		var lastResponse string
+	return sb.String()
+}
 
-		for _, line := range lines {
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
+// formatChatResponse renders the response of a chat call from its parsed parts
+func formatChatResponse(parts *responseParts, response string, opts formatOptions) string {
+	th := opts.theme
+	var sb strings.Builder
 
-			var respData map[string]any
-			if err := json.Unmarshal([]byte(line), &respData); err != nil {
-				continue
+	sb.WriteString(fmt.Sprintf("\n\n[%s]Response:[%s]\n", th.Response, th.Text))
+	if strings.TrimSpace(response) != "" {
+		lastResponse := parts.text.String()
+		sb.WriteString(formatReasoning(parts.reasoning.String(), opts))
+		if lastResponse != "" || len(parts.toolCalls) > 0 {
+			sb.WriteString(fmt.Sprintf("\n[%s]# Assistant[%s]\n", th.Assistant, th.Text))
+			if lastResponse != "" {
+				sb.WriteString(tview.Escape(lastResponse))
+				sb.WriteString("\n")
 			}
+			sb.WriteString(formatToolCalls(parts.toolCalls, opts))
+		} else if parts.errorMessage == "" {
+			sb.WriteString(tview.Escape(response))
+		}
+		sb.WriteString(formatResponseError(parts.errorMessage, opts))
+	}
 
-			// Handle Ollama API response format
-			if message, ok := respData["message"].(map[string]any); ok {
-				if role, roleOk := message["role"].(string); roleOk && role == "assistant" {
-					if content, contentOk := message["content"].(string); contentOk && content != "" {
-						if lastResponse == "" {
-							lastResponse = content
-						} else {
-							lastResponse += content
-						}
-					}
-				}
-			} else if content, ok := respData["response"].(string); ok && content != "" {
-				// Fallback for other response formats
-				lastResponse = content
-			}
+	return sb.String()
+}
+
+// formatCallHeader renders call metadata shown above the formatted request/response
+func formatCallHeader(call types.CallSnapshot, opts formatOptions) string {
+	th := opts.theme
+	var sb strings.Builder
+	if call.Note != "" {
+		sb.WriteString(fmt.Sprintf("[%s]Note:[%s] %s\n", th.Model, th.Text, tview.Escape(call.Note)))
+	}
+	sb.WriteString(fmt.Sprintf("[%s]Started:[%s] %s\n", th.Model, th.Text, tview.Escape(opts.formatTime(call.StartTime, opts.detailTimeFormat))))
+	if call.ReplayOf != "" {
+		sb.WriteString(fmt.Sprintf("[%s]Replay of:[%s] %s\n", th.Model, th.Text, call.ReplayOf))
+	}
+	if call.DuplicateOf != "" {
+		sb.WriteString(fmt.Sprintf("[%s]Duplicate of:[%s] %s\n", th.Model, th.Text, call.DuplicateOf))
+	}
+	if call.ThreadID != "" && call.ThreadID != call.ID {
+		sb.WriteString(fmt.Sprintf("[%s]Thread:[%s] %s\n", th.Model, th.Text, call.ThreadID))
+	}
+	if call.ClientIP != "" {
+		sb.WriteString(fmt.Sprintf("[%s]Client:[%s] %s\n", th.Model, th.Text, tview.Escape(call.ClientIP)))
+	}
+	if call.UserAgent != "" {
+		sb.WriteString(fmt.Sprintf("[%s]User-Agent:[%s] %s\n", th.Model, th.Text, tview.Escape(call.UserAgent)))
+	}
+	if call.TraceID != "" {
+		sb.WriteString(fmt.Sprintf("[%s]Trace:[%s] %s (span %s)\n", th.Model, th.Text, call.TraceID, call.SpanID))
+	}
+	if call.Upstream != "" {
+		sb.WriteString(fmt.Sprintf("[%s]Upstream:[%s] %s\n", th.Model, th.Text, tview.Escape(call.Upstream)))
+	}
+	if call.FinishedByHand {
+		sb.WriteString(fmt.Sprintf("[%s]Finished by hand:[%s] marked as %s while it was still active\n", th.Model, th.Text, call.Status))
+	}
+	if call.Retries > 0 {
+		sb.WriteString(fmt.Sprintf("[%s]Retries:[%s] %d after 429 Too Many Requests\n", th.Model, th.Text, call.Retries))
+	}
+	if call.PromptTokens > 0 || call.CompletionTokens > 0 {
+		sb.WriteString(fmt.Sprintf("[%s]Tokens:[%s] %d prompt, %d completion\n", th.Model, th.Text, call.PromptTokens, call.CompletionTokens))
+	} else if call.PromptEstimate > 0 {
+		sb.WriteString(fmt.Sprintf("[%s]Tokens:[%s] ~%d prompt (estimate)\n", th.Model, th.Text, call.PromptEstimate))
+	}
+	sb.WriteString(formatStats(call.Stats, opts))
+	if call.BytesIn > 0 || call.BytesOut > 0 {
+		sb.WriteString(fmt.Sprintf("[%s]Transferred:[%s] %s in, %s out\n", th.Model, th.Text, formatSize(call.BytesIn), formatSize(call.BytesOut)))
+	}
+	sb.WriteString(formatHeaders("Request headers", call.RequestHeaders, opts))
+	sb.WriteString(formatHeaders("Response headers", call.ResponseHeaders, opts))
+	for _, warning := range call.Warnings {
+		sb.WriteString(fmt.Sprintf("[%s]Warning:[%s] %s\n", th.LogWarn, th.Text, tview.Escape(warning)))
+	}
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// statsBarWidth is the width of the bar drawn for the total duration in the timing breakdown
+const statsBarWidth = 30
+
+// formatStats renders the timings Ollama reported as a breakdown of the total duration into loading the model,
+// evaluating the prompt and generating, each with a bar scaled to the total. Stages that were not reported are left out.
+func formatStats(stats *types.Stats, opts formatOptions) string {
+	if stats == nil {
+		return ""
+	}
+	th := opts.theme
+
+	type stage struct {
+		name     string
+		duration time.Duration
+		tokens   int
+	}
+	stages := []stage{
+		{"load", stats.LoadDuration, 0},
+		{"prompt eval", stats.PromptEvalDuration, stats.PromptEvalCount},
+		{"eval", stats.EvalDuration, stats.EvalCount},
+	}
+	total := stats.TotalDuration
+	var sum time.Duration
+	for _, stage := range stages {
+		sum += stage.duration
+	}
+	if total < sum {
+		total = sum
+	}
+	if total <= 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s]Timing:[%s] %s total", th.Model, th.Text, formatStatsDuration(total)))
+	if stats.ContextLength > 0 {
+		sb.WriteString(fmt.Sprintf(", %d context tokens", stats.ContextLength))
+	}
+	sb.WriteString("\n")
+	if other := total - sum; other > 0 && sum > 0 {
+		stages = append(stages, stage{"other", other, 0})
+	}
+	for _, stage := range stages {
+		if stage.duration <= 0 {
+			continue
+		}
+		bar := strings.Repeat("█", max(1, int(int64(statsBarWidth)*int64(stage.duration)/int64(total))))
+		sb.WriteString(fmt.Sprintf("  %-11s %8s [%s]%-*s[%s]", stage.name, formatStatsDuration(stage.duration), th.Assistant, statsBarWidth, bar, th.Text))
+		if stage.tokens > 0 {
+			sb.WriteString(fmt.Sprintf(" %d tokens, %.1f tok/s", stage.tokens, float64(stage.tokens)/stage.duration.Seconds()))
 		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
 
-		if lastResponse != "" {
-			sb.WriteString(fmt.Sprintf("\n[%s]# Assistant[%s]\n%s\n", assistantColor, textColor, lastResponse))
-		} else {
-			sb.WriteString(response)
+// formatStatsDuration rounds a stage duration to a precision that suits its size
+func formatStatsDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(time.Millisecond).String()
+	default:
+		return d.Round(time.Microsecond).String()
+	}
+}
+
+// formatHeaders renders captured headers sorted by name
+func formatHeaders(title string, header http.Header, opts formatOptions) string {
+	if len(header) == 0 {
+		return ""
+	}
+	th := opts.theme
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s]%s:[%s]\n", th.Model, title, th.Text))
+	for _, name := range slices.Sorted(maps.Keys(header)) {
+		for _, value := range header[name] {
+			sb.WriteString(fmt.Sprintf("  [%s]%s:[%s] %s\n", th.Role, tview.Escape(name), th.Text, tview.Escape(value)))
+		}
+	}
+	return sb.String()
+}
+
+// formatRaw renders the request and response exactly as they were sent over the wire
+func formatRaw(request, response string, opts formatOptions) string {
+	th := opts.theme
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s]Request:[%s]\n", th.Prompt, th.Text))
+	sb.WriteString(tview.Escape(request))
+	sb.WriteString(fmt.Sprintf("\n\n[%s]Response:[%s]\n", th.Response, th.Text))
+	sb.WriteString(tview.Escape(response))
+	return sb.String()
+}
+
+// formatVersion renders the response of /api/version
+func formatVersion(request, response string, opts formatOptions) string {
+	th := opts.theme
+	var data struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(response), &data); err != nil || data.Version == "" {
+		return formatRaw(request, response, opts)
+	}
+	return fmt.Sprintf("[%s]Version:[%s] %s\n", th.Model, th.Text, tview.Escape(data.Version))
+}
+
+// formatTags renders the model list of /api/tags as a table
+func formatTags(request, response string, opts formatOptions) string {
+	th := opts.theme
+	var data struct {
+		Models []struct {
+			Name       string    `json:"name"`
+			Size       int       `json:"size"`
+			ModifiedAt time.Time `json:"modified_at"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal([]byte(response), &data); err != nil {
+		return formatRaw(request, response, opts)
+	}
+
+	width := len("Name")
+	for _, model := range data.Models {
+		width = max(width, len(model.Name))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s]Models (%d):[%s]\n\n", th.Model, len(data.Models), th.Text))
+	sb.WriteString(fmt.Sprintf("[%s]%-*s  %10s  %s[%s]\n", th.Role, width, "Name", "Size", "Modified", th.Text))
+	for _, model := range data.Models {
+		modified := ""
+		if !model.ModifiedAt.IsZero() {
+			modified = opts.formatTime(model.ModifiedAt, "2006-01-02 15:04")
+		}
+		sb.WriteString(fmt.Sprintf("%-*s  %10s  %s\n", width, tview.Escape(model.Name), formatSize(model.Size), modified))
+	}
+	return sb.String()
+}
+
+// formatShow renders the model information returned by /api/show
+func formatShow(request, response string, opts formatOptions) string {
+	th := opts.theme
+	var data struct {
+		Modelfile  string `json:"modelfile"`
+		Parameters string `json:"parameters"`
+		Template   string `json:"template"`
+		System     string `json:"system"`
+		Details    struct {
+			Family            string `json:"family"`
+			Format            string `json:"format"`
+			ParameterSize     string `json:"parameter_size"`
+			QuantizationLevel string `json:"quantization_level"`
+		} `json:"details"`
+		ModelInfo    map[string]any `json:"model_info"`
+		Capabilities []string       `json:"capabilities"`
+	}
+	if err := json.Unmarshal([]byte(response), &data); err != nil {
+		return formatRaw(request, response, opts)
+	}
+
+	var sb strings.Builder
+	if model := requestModel(request); model != "" {
+		sb.WriteString(fmt.Sprintf("[%s]Model:[%s] %s\n", th.Model, th.Text, tview.Escape(model)))
+	}
+	details := []struct{ name, value string }{
+		{"Family", data.Details.Family},
+		{"Format", data.Details.Format},
+		{"Parameter size", data.Details.ParameterSize},
+		{"Quantization", data.Details.QuantizationLevel},
+		{"Capabilities", strings.Join(data.Capabilities, ", ")},
+	}
+	for key, value := range data.ModelInfo {
+		if strings.HasSuffix(key, ".context_length") {
+			details = append(details, struct{ name, value string }{"Context length", fmt.Sprint(value)})
+		}
+	}
+	for _, detail := range details {
+		if detail.value != "" {
+			sb.WriteString(fmt.Sprintf("[%s]%s:[%s] %s\n", th.Role, detail.name, th.Text, tview.Escape(detail.value)))
+		}
+	}
+
+	for _, section := range []struct{ title, text string }{
+		{"Parameters", data.Parameters},
+		{"System", data.System},
+		{"Template", data.Template},
+		{"Modelfile", data.Modelfile},
+	} {
+		if strings.TrimSpace(section.text) != "" {
+			sb.WriteString(fmt.Sprintf("\n[%s]%s:[%s]\n%s\n", th.Prompt, section.title, th.Text, tview.Escape(strings.TrimSpace(section.text))))
 		}
 	}
+	return sb.String()
+}
+
+// formatPs renders the models loaded in memory from /api/ps as a table
+func formatPs(request, response string, opts formatOptions) string {
+	th := opts.theme
+	var data struct {
+		Models []struct {
+			Name          string    `json:"name"`
+			Size          int       `json:"size"`
+			SizeVRAM      int       `json:"size_vram"`
+			ContextLength int       `json:"context_length"`
+			ExpiresAt     time.Time `json:"expires_at"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal([]byte(response), &data); err != nil {
+		return formatRaw(request, response, opts)
+	}
+
+	width := len("Name")
+	for _, model := range data.Models {
+		width = max(width, len(model.Name))
+	}
 
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s]Loaded models (%d):[%s]\n\n", th.Model, len(data.Models), th.Text))
+	sb.WriteString(fmt.Sprintf("[%s]%-*s  %10s  %10s  %8s  %7s  %s[%s]\n", th.Role, width, "Name", "Size", "VRAM", "GPU", "Context", "Until", th.Text))
+	for _, model := range data.Models {
+		gpu := ""
+		if model.Size > 0 {
+			gpu = fmt.Sprintf("%d%%", model.SizeVRAM*100/model.Size)
+		}
+		context := ""
+		if model.ContextLength > 0 {
+			context = fmt.Sprint(model.ContextLength)
+		}
+		until := ""
+		if !model.ExpiresAt.IsZero() {
+			until = tview.Escape(opts.formatTime(model.ExpiresAt, opts.listTimeFormat))
+		}
+		sb.WriteString(fmt.Sprintf("%-*s  %10s  %10s  %8s  %7s  %s\n", width, tview.Escape(model.Name),
+			formatSize(model.Size), formatSize(model.SizeVRAM), gpu, context, until))
+	}
 	return sb.String()
 }
 
+// requestModel returns the model named in a request body, accepting the older "name" field too
+func requestModel(request string) string {
+	var req struct {
+		Model string `json:"model"`
+		Name  string `json:"name"`
+	}
+	json.Unmarshal([]byte(request), &req)
+	if req.Model != "" {
+		return req.Model
+	}
+	return req.Name
+}
+
+// toggleBaseline makes the selected call the baseline other calls are compared to,
+// or clears the baseline if it is already selected
+func (t *TUI) toggleBaseline() {
+	if t.selectedID == "" || t.selectedID == t.baselineID {
+		t.baselineID = ""
+	} else {
+		t.baselineID = t.selectedID
+	}
+	t.updateDetailView()
+}
+
+// updateDetailTitle shows the current rendering mode in the detail view title
+func (t *TUI) updateDetailTitle() {
+	mode := "formatted"
+	switch {
+	case t.rawMode:
+		mode = "raw"
+	case t.baselineID == t.selectedID && t.baselineID != "":
+		mode = "baseline"
+	case t.baselineID != "":
+		mode = "diff"
+	}
+	search := ""
+	if t.searchQuery != "" {
+		search = fmt.Sprintf(" - %q %d/%d", t.searchQuery, min(t.searchIndex+1, t.searchMatches), t.searchMatches)
+	}
+	t.detailView.SetTitle(fmt.Sprintf(" Details (%s)%s ", mode, search))
+}
+
 func (t *TUI) updateDetailView() {
 	if t.selectedID == "" {
 		t.detailView.Clear()
@@ -400,26 +1467,115 @@ func (t *TUI) updateDetailView() {
 		return
 	}
 
-	var displayText string
+	baseline, hasBaseline := t.tracker.GetCall(t.baselineID)
+	if !hasBaseline {
+		t.baselineID = ""
+	}
+
+	// One snapshot for the header and the bodies, so that they agree while the call is streaming
+	snapshot := call.Snapshot()
+	var sb strings.Builder
+	sb.WriteString(formatCallHeader(snapshot, t.formatOpts))
+
+	request, response := snapshot.Request, snapshot.Response
 	switch {
+	case t.rawMode:
+		sb.WriteString(formatRaw(request, response, t.formatOpts))
+	case hasBaseline && baseline.ID != call.ID:
+		sb.WriteString(formatCallDiff(baseline, call, t.formatOpts))
 	case strings.HasSuffix(call.Endpoint, "/api/chat"):
-		displayText = formatChatMessages(call.Request, call.Response)
+		sb.WriteString(t.cachedDetails(call.ID, request, response, formatChatRequest, formatChatResponse))
 	case strings.HasSuffix(call.Endpoint, "/api/generate"):
-		displayText = formatGenerateMessages(call.Request, call.Response)
+		sb.WriteString(t.cachedDetails(call.ID, request, response, formatGenerateRequest, formatGenerateResponse))
+	case strings.HasSuffix(call.Endpoint, "/api/version"):
+		sb.WriteString(formatVersion(request, response, t.formatOpts))
+	case strings.HasSuffix(call.Endpoint, "/api/tags"):
+		sb.WriteString(formatTags(request, response, t.formatOpts))
+	case strings.HasSuffix(call.Endpoint, "/api/show"):
+		sb.WriteString(formatShow(request, response, t.formatOpts))
+	case strings.HasSuffix(call.Endpoint, "/api/ps"):
+		sb.WriteString(formatPs(request, response, t.formatOpts))
+	case isProgressEndpoint(call.Endpoint):
+		sb.WriteString(formatProgress(request, response, t.formatOpts))
 	default:
 		// Fallback to raw display for other endpoints
-		var sb strings.Builder
-		sb.WriteString(fmt.Sprintf("[%s]Request:[%s]\n", promptColor, textColor))
-		sb.WriteString(call.Request)
-		sb.WriteString(fmt.Sprintf("\n\n[%s]Response:[%s]\n", responseColor, textColor))
-		sb.WriteString(call.Response)
-		displayText = sb.String()
+		sb.WriteString(formatRaw(request, response, t.formatOpts))
 	}
 
-	t.detailView.SetText(displayText)
+	text, matches := highlightMatches(sb.String(), t.searchQuery)
+	t.searchMatches = matches
+	if t.searchIndex >= matches {
+		t.searchIndex = 0
+	}
+	t.detailView.SetText(text)
+	if t.searchQuery != "" {
+		t.showMatch()
+		return
+	}
+	t.updateDetailTitle()
+	t.detailView.Highlight()
+	if t.hasPendingDetailScroll {
+		t.detailView.ScrollTo(t.pendingDetailScroll, 0)
+		t.hasPendingDetailScroll = false
+		return
+	}
 	t.detailView.ScrollToEnd()
 }
 
+// redrawInterval bounds how often progress of streaming calls is redrawn
+const redrawInterval = 50 * time.Millisecond
+
+// consumeEvents redraws the UI for tracker events. Progress events are coalesced and
+// applied at most every redrawInterval, a finished call is shown right away.
+func (t *TUI) consumeEvents() {
+	defer t.closeLog()
+
+	pending := make(map[string]bool)
+	var tick <-chan time.Time
+	events := t.tracker.Events()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			pending[event.ID] = true
+			if !event.Done {
+				if tick == nil {
+					tick = time.After(redrawInterval)
+				}
+				continue
+			}
+		case <-tick:
+		}
+
+		// While paused the events are dropped, resuming redraws everything anyway
+		if !t.paused.Load() {
+			t.redraw(pending)
+		}
+		pending = make(map[string]bool)
+		tick = nil
+	}
+}
+
+// redraw refreshes the list, status and statistics, and the details if the selected call changed
+func (t *TUI) redraw(changed map[string]bool) {
+	t.app.QueueUpdateDraw(func() {
+		// Update the call list to show the latest calls
+		prevSelected := t.selectedID
+		t.updateCallList()
+
+		// If one of the changed calls is the currently selected one, update the detail view
+		if changed[prevSelected] || prevSelected == "" {
+			t.updateDetailView()
+		}
+		t.updateStatus()
+		if front, _ := t.pages.GetFrontPage(); front == statsPage {
+			t.updateStats()
+		}
+	})
+}
+
 type logWriter struct {
 	tui *TUI
 }
@@ -457,8 +1613,7 @@ func (t *TUI) closeLog() {
 func (t *TUI) startLogProcessor() {
 	for msg := range t.logChan {
 		t.app.QueueUpdateDraw(func() {
-			fmt.Fprint(t.logView, msg)
-			t.logView.ScrollToEnd()
+			t.appendLog(msg)
 		})
 	}
 }
@@ -468,27 +1623,36 @@ func (t *TUI) Run() error {
 	go t.startLogProcessor()
 
 	// Set the app root and run
-	t.app.SetRoot(t.flex, true).SetFocus(t.callList)
+	t.app.SetRoot(t.pages, true).SetFocus(t.callList)
+
+	state, restore := t.loadState()
+	if restore {
+		t.restoreSettings(state)
+	}
 
 	// Initial update
 	t.updateCallList()
+	if restore {
+		t.restorePosition(state)
+	}
 
 	// Start a goroutine to update the UI
-	go func() {
-		defer t.closeLog()
-		for event := range t.tracker.Events() {
-			t.app.QueueUpdateDraw(func() {
-				// Update the call list to show the latest calls
-				prevSelected := t.selectedID
-				t.updateCallList()
+	go t.consumeEvents()
 
-				// If this event is for the currently selected call, update the detail view
-				if event.ID == prevSelected || prevSelected == "" {
-					t.updateDetailView()
-				}
-			})
+	if t.name != "" {
+		t.app.SetTitle(t.name + " - ollama-proxy")
+	}
+	t.app.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+		if t.clipboard != nil {
+			screen.SetClipboard(t.clipboard)
+			t.clipboard = nil
 		}
-	}()
+		return false
+	})
 
-	return t.app.Run()
+	if err := t.app.Run(); err != nil {
+		return err
+	}
+	t.saveState()
+	return nil
 }
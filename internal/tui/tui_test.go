@@ -0,0 +1,406 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rivo/tview"
+
+	"ollama-proxy/internal/types"
+)
+
+var testOpts = formatOptions{
+	theme:            themes[DefaultTheme],
+	location:         time.UTC,
+	listTimeFormat:   defaultListTimeFormat,
+	detailTimeFormat: defaultDetailTimeFormat,
+}
+
+// plainText returns what the detail view shows of the markup: the text without its color tags, with
+// escaped brackets as they were before escaping
+func plainText(markup string) string {
+	return tview.NewTextView().SetDynamicColors(true).SetRegions(true).SetText(markup).GetText(true)
+}
+
+// checkText fails the test unless the shown text contains every string of want and none of notWant
+func checkText(t *testing.T, markup string, want, notWant []string) {
+	t.Helper()
+	text := plainText(markup)
+	for _, s := range want {
+		if !strings.Contains(text, s) {
+			t.Errorf("missing %q in:\n%s", s, text)
+		}
+	}
+	for _, s := range notWant {
+		if strings.Contains(text, s) {
+			t.Errorf("unexpected %q in:\n%s", s, text)
+		}
+	}
+}
+
+func TestFormatGenerateMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  string
+		response string
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:     "single object",
+			request:  `{"model":"llama3","prompt":"Why is the sky blue?","stream":false}`,
+			response: `{"model":"llama3","response":"Rayleigh scattering.","done":true}`,
+			want:     []string{"Model: llama3", "Prompt:\nWhy is the sky blue?", "Response:\nRayleigh scattering."},
+		},
+		{
+			name:    "streamed",
+			request: `{"model":"llama3","prompt":"Why is the sky blue?"}`,
+			response: `{"response":"The","done":false}` + "\n" +
+				`{"response":" sky","done":false}` + "\n" +
+				`{"response":" scatters light.","done":false}` + "\n" +
+				`{"response":"","done":true,"context":[1,2,3]}` + "\n",
+			want:    []string{"Response:\nThe sky scatters light.\n", "returned 3 tokens to continue from"},
+			notWant: []string{`"done"`},
+		},
+		{
+			name:     "streamed with reasoning",
+			request:  `{"model":"qwen3","prompt":"2+2?"}`,
+			response: `{"thinking":"Add them.","response":""}` + "\n" + `{"response":"4","done":true}` + "\n",
+			want:     []string{"▼ Reasoning:\nAdd them.", "4"},
+		},
+		{
+			name:     "tag syntax in prompt and response",
+			request:  `{"model":"[blue]m","prompt":"[red]alert[-] and [::b]bold"}`,
+			response: `{"response":"[yellow]warning[\"region\"]","done":true}`,
+			want:     []string{"Model: [blue]m", "[red]alert[-] and [::b]bold", `[yellow]warning["region"]`},
+		},
+		{
+			name:     "error",
+			request:  `{"model":"missing","prompt":"hi"}`,
+			response: `{"error":"model \"missing\" not found, try pulling it first"}`,
+			want:     []string{`Error: model "missing" not found, try pulling it first`},
+			notWant:  []string{`{"error"`},
+		},
+		{
+			name:     "malformed request and response",
+			request:  `{"model":`,
+			response: `not [red]json`,
+			want:     []string{"Prompt:\n{\"model\":", "Response:\nnot [red]json"},
+		},
+		{
+			name:    "request without prompt",
+			request: `{"model":"llama3"}`,
+			want:    []string{"Model: llama3", `Prompt:` + "\n" + `{"model":"llama3"}`},
+		},
+		{
+			name:    "empty",
+			want:    []string{"Prompt:", "Response:"},
+			notWant: []string{"Model:", "Error:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkText(t, formatGenerateMessages(tt.request, tt.response, testOpts), tt.want, tt.notWant)
+		})
+	}
+}
+
+func TestFormatChatMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  string
+		response string
+		opts     *formatOptions
+		want     []string
+		notWant  []string
+	}{
+		{
+			name: "roles",
+			request: `{"model":"llama3","messages":[` +
+				`{"role":"system","content":"You are terse."},` +
+				`{"role":"user","content":"Hello"},` +
+				`{"role":"assistant","content":"Hi."},` +
+				`{"role":"user","content":"How are you?"}]}`,
+			response: `{"message":{"role":"assistant","content":"Fine."},"done":true}`,
+			want: []string{"Model: llama3", "# System\nYou are terse.", "# User\nHello", "# Assistant\nHi.",
+				"# User\nHow are you?", "Response:\n\n# Assistant\nFine."},
+		},
+		{
+			name:    "streamed deltas",
+			request: `{"model":"llama3","messages":[{"role":"user","content":"Hello"}]}`,
+			response: `{"message":{"role":"assistant","content":"Hel"},"done":false}` + "\n" +
+				`{"message":{"role":"assistant","content":"lo"},"done":false}` + "\n" +
+				`{"message":{"role":"assistant","content":" there!"},"done":false}` + "\n" +
+				`{"message":{"role":"assistant","content":""},"done":true,"eval_count":3}` + "\n",
+			want:    []string{"# Assistant\nHello there!\n"},
+			notWant: []string{`"message"`},
+		},
+		{
+			name:    "streamed reasoning",
+			request: `{"model":"qwen3","messages":[{"role":"user","content":"2+2?"}]}`,
+			response: `{"message":{"role":"assistant","content":"","thinking":"Simple "}}` + "\n" +
+				`{"message":{"role":"assistant","content":"","thinking":"sum."}}` + "\n" +
+				`{"message":{"role":"assistant","content":"4"},"done":true}` + "\n",
+			want: []string{"▼ Reasoning:\nSimple sum.", "# Assistant\n4"},
+		},
+		{
+			name:     "hidden reasoning",
+			request:  `{"model":"qwen3","messages":[{"role":"user","content":"2+2?"}]}`,
+			response: `{"message":{"role":"assistant","content":"4","thinking":"Simple sum."},"done":true}`,
+			opts:     &formatOptions{theme: testOpts.theme, hideReasoning: true},
+			want:     []string{"▶ Reasoning (11 chars, T to expand)", "# Assistant\n4"},
+			notWant:  []string{"Simple sum."},
+		},
+		{
+			name: "tools and tool calls",
+			request: `{"model":"llama3","messages":[{"role":"user","content":"Weather?"}],"tools":[` +
+				`{"type":"function","function":{"name":"[yellow]get_weather","description":"Weather for a [b]city"}},` +
+				`{"type":"function","function":{"description":"nameless"}}]}`,
+			response: `{"message":{"role":"assistant","content":"","tool_calls":[` +
+				`{"function":{"name":"get_[red]weather","arguments":{"city":"[Paris]"}}}]},"done":true}`,
+			want:    []string{"Tools:\n  [yellow]get_weather - Weather for a [b]city\n", `→ get_[red]weather({"city":"[Paris]"})`},
+			notWant: []string{"nameless"},
+		},
+		{
+			name: "tool results",
+			request: `{"model":"llama3","messages":[` +
+				`{"role":"assistant","content":"","tool_calls":[{"function":{"name":"lookup","arguments":"{\"q\":1}"}}]},` +
+				`{"role":"tool","tool_name":"lookup","content":"[42]"}]}`,
+			response: `{"message":{"role":"assistant","content":"It is 42."},"done":true}`,
+			want:     []string{"# Assistant\n→ lookup({\"q\":1})", "# Tool (lookup)\n[42]"},
+		},
+		{
+			name:     "tag syntax in messages",
+			request:  `{"model":"llama3","messages":[{"role":"user","content":"say [green]hi[-]"}]}`,
+			response: `{"message":{"role":"assistant","content":"[green]hi[-]"},"done":true}`,
+			want:     []string{"# User\nsay [green]hi[-]", "# Assistant\n[green]hi[-]"},
+		},
+		{
+			name:     "error",
+			request:  `{"model":"llama3","messages":[{"role":"user","content":"Hello"}]}`,
+			response: `{"error":"context canceled"}`,
+			want:     []string{"Error: context canceled"},
+			notWant:  []string{"# Assistant", `{"error"`},
+		},
+		{
+			name:     "malformed response",
+			request:  `{"model":"llama3","messages":[{"role":"user","content":"Hello"}]}`,
+			response: `{"message":{"role":"assis`,
+			want:     []string{`Response:` + "\n" + `{"message":{"role":"assis`},
+			notWant:  []string{"# Assistant"},
+		},
+		{
+			name:     "request without messages",
+			request:  `{"model":"llama3","prompt":"[x]"}`,
+			response: "",
+			want:     []string{`Request:` + "\n" + `{"model":"llama3","prompt":"[x]"}`},
+		},
+		{
+			name:    "empty",
+			want:    []string{"Response:"},
+			notWant: []string{"# Assistant", "Model:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOpts
+			if tt.opts != nil {
+				opts = *tt.opts
+			}
+			checkText(t, formatChatMessages(tt.request, tt.response, opts), tt.want, tt.notWant)
+		})
+	}
+}
+
+func TestFormatToolCalls(t *testing.T) {
+	tests := []struct {
+		name      string
+		toolCalls []any
+		want      string
+	}{
+		{
+			name:      "object arguments",
+			toolCalls: []any{map[string]any{"function": map[string]any{"name": "add", "arguments": map[string]any{"a": 1.0}}}},
+			want:      "→ add({\"a\":1})\n",
+		},
+		{
+			name:      "string arguments",
+			toolCalls: []any{map[string]any{"function": map[string]any{"name": "add", "arguments": `{"a":1}`}}},
+			want:      "→ add({\"a\":1})\n",
+		},
+		{
+			name:      "no arguments",
+			toolCalls: []any{map[string]any{"function": map[string]any{"name": "now"}}},
+			want:      "→ now()\n",
+		},
+		{
+			name: "tag syntax",
+			toolCalls: []any{map[string]any{"function": map[string]any{
+				"name": "[red]x[-]", "arguments": map[string]any{"s": "[::b]"}}}},
+			want: "→ [red]x[-]({\"s\":\"[::b]\"})\n",
+		},
+		{
+			name:      "without name",
+			toolCalls: []any{map[string]any{"function": map[string]any{"arguments": "{}"}}, "not a call"},
+			want:      "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := plainText(formatToolCalls(tt.toolCalls, testOpts)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		reqData map[string]any
+		want    string
+	}{
+		{
+			name:    "no tools",
+			reqData: map[string]any{"model": "llama3"},
+			want:    "",
+		},
+		{
+			name: "with and without description",
+			reqData: map[string]any{"tools": []any{
+				map[string]any{"function": map[string]any{"name": "add", "description": "Adds numbers"}},
+				map[string]any{"function": map[string]any{"name": "now"}},
+			}},
+			want: "Tools:\n  add - Adds numbers\n  now\n\n",
+		},
+		{
+			name: "tag syntax",
+			reqData: map[string]any{"tools": []any{
+				map[string]any{"function": map[string]any{"name": "[red]add", "description": "a [b] c [\"r\"]"}},
+			}},
+			want: "Tools:\n  [red]add - a [b] c [\"r\"]\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := plainText(formatTools(tt.reqData, testOpts)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatCallHeader(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 6_000_000, time.UTC)
+	tests := []struct {
+		name    string
+		call    types.CallSnapshot
+		opts    *formatOptions
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "minimal",
+			call:    types.CallSnapshot{ID: "1", StartTime: start},
+			want:    []string{"Started: 2026-01-02 03:04:05.006 UTC\n"},
+			notWant: []string{"Note:", "Tokens:", "Upstream:", "Retries:"},
+		},
+		{
+			name: "time zone and layout",
+			call: types.CallSnapshot{ID: "1", StartTime: start},
+			opts: &formatOptions{theme: testOpts.theme, location: time.FixedZone("CET", 3600), detailTimeFormat: "15:04:05 MST"},
+			want: []string{"Started: 04:04:05 CET\n"},
+		},
+		{
+			name: "metadata",
+			call: types.CallSnapshot{
+				ID:               "2",
+				StartTime:        start,
+				Note:             "[red]check[-] this",
+				ReplayOf:         "1",
+				Upstream:         "http://gpu[1]:11434",
+				UserAgent:        "client/[1.0]",
+				Status:           types.StatusError,
+				FinishedByHand:   true,
+				Retries:          2,
+				PromptTokens:     10,
+				CompletionTokens: 20,
+				BytesIn:          2048,
+				Warnings:         []string{"unknown field [x]"},
+			},
+			want: []string{
+				"Note: [red]check[-] this\n",
+				"Replay of: 1\n",
+				"Upstream: http://gpu[1]:11434\n",
+				"User-Agent: client/[1.0]\n",
+				"Finished by hand: marked as " + string(types.StatusError),
+				"Retries: 2 after 429 Too Many Requests\n",
+				"Tokens: 10 prompt, 20 completion\n",
+				"Transferred: ",
+				"Warning: unknown field [x]\n",
+			},
+		},
+		{
+			name:    "prompt estimate",
+			call:    types.CallSnapshot{ID: "3", StartTime: start, PromptEstimate: 7},
+			want:    []string{"Tokens: ~7 prompt (estimate)\n"},
+			notWant: []string{"completion"},
+		},
+		{
+			name:    "thread of its own",
+			call:    types.CallSnapshot{ID: "4", StartTime: start, ThreadID: "4"},
+			notWant: []string{"Thread:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOpts
+			if tt.opts != nil {
+				opts = *tt.opts
+			}
+			checkText(t, formatCallHeader(tt.call, opts), tt.want, tt.notWant)
+		})
+	}
+}
+
+func TestFormatModelLists(t *testing.T) {
+	opts := testOpts
+	opts.location = time.FixedZone("CET", 3600)
+	tests := []struct {
+		name     string
+		format   func(request, response string, opts formatOptions) string
+		response string
+		want     []string
+	}{
+		{
+			name:     "version",
+			format:   formatVersion,
+			response: `{"version":"0.9.[1]"}`,
+			want:     []string{"Version: 0.9.[1]"},
+		},
+		{
+			name:     "tags",
+			format:   formatTags,
+			response: `{"models":[{"name":"llama3:[8b]","size":1024,"modified_at":"2026-01-02T03:04:05Z"}]}`,
+			want:     []string{"Models (1):", "llama3:[8b]", "2026-01-02 04:04"},
+		},
+		{
+			name:     "ps",
+			format:   formatPs,
+			response: `{"models":[{"name":"llama3","size":1000,"size_vram":500,"context_length":4096,"expires_at":"2026-01-02T03:04:05Z"}]}`,
+			want:     []string{"Loaded models (1):", "50%", "4096", "04:04:05"},
+		},
+		{
+			name:     "malformed",
+			format:   formatTags,
+			response: `[red]oops`,
+			want:     []string{"Response:\n[red]oops"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkText(t, tt.format("{}", tt.response, opts), tt.want, nil)
+		})
+	}
+}
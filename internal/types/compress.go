@@ -0,0 +1,72 @@
+package types
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// Compress gzips the request and response of a finished call to save memory. Bodies, Snapshot and the
+// text accessors decompress them transparently.
+func (c *Call) Compress() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.compressed || c.Request == "" && c.Response == "" {
+		return
+	}
+	c.compressedRequest = gzipString(c.Request)
+	c.compressedResponse = gzipString(c.Response)
+	c.Request, c.Response = "", ""
+	c.response = strings.Builder{}
+	c.compressed = true
+}
+
+// Bodies returns the request and response of the call, decompressing them if needed
+func (c *Call) Bodies() (request, response string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bodies()
+}
+
+// bodies returns the request and response of the call. The caller must hold c.mu.
+func (c *Call) bodies() (request, response string) {
+	if !c.compressed {
+		return c.Request, c.Response
+	}
+	return gunzipString(c.compressedRequest), gunzipString(c.compressedResponse)
+}
+
+// decompress restores the plain request and response, e.g. when more of the response arrives after all.
+// The caller must hold c.mu.
+func (c *Call) decompress() {
+	if !c.compressed {
+		return
+	}
+	c.Request, c.Response = c.bodies()
+	c.compressedRequest, c.compressedResponse = nil, nil
+	c.compressed = false
+}
+
+func gzipString(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func gunzipString(data []byte) string {
+	if data == nil {
+		return ""
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	s, _ := io.ReadAll(zr)
+	return string(s)
+}
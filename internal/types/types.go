@@ -1,6 +1,10 @@
 package types
 
 import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,53 +16,510 @@ const (
 	StatusDone         CallStatus = "done"
 	StatusError        CallStatus = "error"
 	StatusDisconnected CallStatus = "disconnected"
+	StatusRateLimited  CallStatus = "rate_limited"
 )
 
 type Call struct {
 	ID        string
 	Method    string
 	Endpoint  string
+	Model     string
+	Upstream  string
+	ReplayOf  string
+	ClientIP  string
+	UserAgent string
 	Status    CallStatus
 	StartTime time.Time
 	EndTime   *time.Time
-	Request   string
-	Response  string
-	mu        sync.Mutex
+
+	// Request and Response are the bodies of the call. They are empty once Compress was called,
+	// read them with Bodies or Snapshot.
+	Request  string
+	Response string
+
+	// BytesIn is the size of the request body, BytesOut the number of response bytes received from upstream
+	BytesIn  int
+	BytesOut int
+
+	// W3C trace context of the call, only set when tracing is enabled
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+
+	// StatusCode is the HTTP status code sent to the client, zero until the response starts
+	StatusCode int
+
+	// DuplicateOf is the call whose response this identical concurrent call shared
+	DuplicateOf string
+
+	// Headers are only captured when enabled, with sensitive values redacted
+	RequestHeaders  http.Header
+	ResponseHeaders http.Header
+
+	// Warnings are problems found in the request body, only set when validation is enabled
+	Warnings []string
+
+	// RequestStreamed is set when the request body was too large to be buffered and was forwarded
+	// without being captured
+	RequestStreamed bool
+
+	// Token counts as reported by Ollama in the final response object
+	PromptTokens     int
+	CompletionTokens int
+
+	// PromptEstimate is a rough prompt token count computed from the request, until Ollama reports the actual one
+	PromptEstimate int
+
+	// Error is the message of an error object in the response, e.g. "model not found"
+	Error string
+
+	// Retries counts how often the request was sent again after the upstream answered 429
+	Retries int
+
+	// Stats are the timings from the final object of a chat or generate response, nil until it arrived
+	Stats *Stats
+
+	// ThreadID groups the chat calls of one conversation, it is the ID of the call that started it.
+	// Every other call is a thread of its own.
+	ThreadID string
+
+	// Note is free text the user attached to the call while debugging
+	Note string
+
+	// FinishedByHand is set when the user marked the call as done or failed while it looked stuck.
+	// The proxy no longer changes its status afterwards.
+	FinishedByHand bool
+
+	// cancel aborts the upstream request of the call, nil once it is no longer forwarded
+	cancel func()
+
+	// compressed is set once Compress gzipped the request and response into compressedRequest and
+	// compressedResponse, Request and Response are empty then
+	compressed         bool
+	compressedRequest  []byte
+	compressedResponse []byte
+
+	// response grows with every chunk and Response shares its bytes, so that appending a chunk does not
+	// copy the whole response so far
+	response strings.Builder
+
+	mu sync.Mutex
+}
+
+// CallSnapshot is a consistent copy of a call for serialization, free of locks
+type CallSnapshot struct {
+	ID               string      `json:"id"`
+	Method           string      `json:"method"`
+	Endpoint         string      `json:"endpoint"`
+	Model            string      `json:"model,omitempty"`
+	Upstream         string      `json:"upstream,omitempty"`
+	ReplayOf         string      `json:"replay_of,omitempty"`
+	ThreadID         string      `json:"thread_id,omitempty"`
+	DuplicateOf      string      `json:"duplicate_of,omitempty"`
+	ClientIP         string      `json:"client_ip,omitempty"`
+	UserAgent        string      `json:"user_agent,omitempty"`
+	Status           CallStatus  `json:"status"`
+	StatusCode       int         `json:"status_code,omitempty"`
+	StartTime        time.Time   `json:"start_time"`
+	EndTime          *time.Time  `json:"end_time,omitempty"`
+	DurationMs       int64       `json:"duration_ms"`
+	PromptTokens     int         `json:"prompt_tokens"`
+	PromptEstimate   int         `json:"prompt_estimate,omitempty"`
+	CompletionTokens int         `json:"completion_tokens"`
+	BytesIn          int         `json:"bytes_in"`
+	BytesOut         int         `json:"bytes_out"`
+	TraceID          string      `json:"trace_id,omitempty"`
+	SpanID           string      `json:"span_id,omitempty"`
+	ParentSpanID     string      `json:"parent_span_id,omitempty"`
+	Error            string      `json:"error,omitempty"`
+	Retries          int         `json:"retries,omitempty"`
+	Stats            *Stats      `json:"stats,omitempty"`
+	Warnings         []string    `json:"warnings,omitempty"`
+	RequestStreamed  bool        `json:"request_streamed,omitempty"`
+	RequestHeaders   http.Header `json:"request_headers,omitempty"`
+	ResponseHeaders  http.Header `json:"response_headers,omitempty"`
+	Request          string      `json:"request"`
+	Response         string      `json:"response"`
+
+	Note           string `json:"note,omitempty"`
+	FinishedByHand bool   `json:"finished_by_hand,omitempty"`
+}
+
+// Snapshot returns a copy of the call taken atomically
+func (c *Call) Snapshot() CallSnapshot {
+	return c.snapshot(true)
+}
+
+// SnapshotWithoutBodies is Snapshot with empty Request and Response, saving the copy or decompression
+// of the bodies
+func (c *Call) SnapshotWithoutBodies() CallSnapshot {
+	return c.snapshot(false)
+}
+
+func (c *Call) snapshot(withBodies bool) CallSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var request, response string
+	if withBodies {
+		request, response = c.bodies()
+	}
+	end := time.Now()
+	var endTime *time.Time
+	if c.EndTime != nil {
+		end = *c.EndTime
+		endTime = &end
+	}
+	return CallSnapshot{
+		ID:               c.ID,
+		Method:           c.Method,
+		Endpoint:         c.Endpoint,
+		Model:            c.Model,
+		Upstream:         c.Upstream,
+		ReplayOf:         c.ReplayOf,
+		ThreadID:         c.ThreadID,
+		DuplicateOf:      c.DuplicateOf,
+		ClientIP:         c.ClientIP,
+		UserAgent:        c.UserAgent,
+		Status:           c.Status,
+		StatusCode:       c.StatusCode,
+		StartTime:        c.StartTime,
+		EndTime:          endTime,
+		DurationMs:       end.Sub(c.StartTime).Milliseconds(),
+		PromptTokens:     c.PromptTokens,
+		PromptEstimate:   c.PromptEstimate,
+		CompletionTokens: c.CompletionTokens,
+		BytesIn:          c.BytesIn,
+		BytesOut:         c.BytesOut,
+		TraceID:          c.TraceID,
+		SpanID:           c.SpanID,
+		ParentSpanID:     c.ParentSpanID,
+		Error:            c.Error,
+		Retries:          c.Retries,
+		Stats:            c.Stats,
+		Warnings:         slices.Clone(c.Warnings),
+		RequestStreamed:  c.RequestStreamed,
+		RequestHeaders:   c.RequestHeaders.Clone(),
+		ResponseHeaders:  c.ResponseHeaders.Clone(),
+		Request:          request,
+		Response:         response,
+
+		Note:           c.Note,
+		FinishedByHand: c.FinishedByHand,
+	}
+}
+
+// IsActive reports whether the call is still in progress
+func (c *Call) IsActive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Status == StatusActive
+}
+
+// CurrentStatus returns the status of the call
+func (c *Call) CurrentStatus() CallStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Status
+}
+
+// Duration returns the elapsed time so far for active calls and the final duration otherwise
+func (c *Call) Duration() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Status != StatusActive && c.EndTime != nil {
+		return c.EndTime.Sub(c.StartTime)
+	}
+	return time.Since(c.StartTime)
+}
+
+// ResponseText returns the assistant text of the response received so far
+func (c *Call) ResponseText() string {
+	_, response := c.Bodies()
+	return ResponseText(response)
+}
+
+// ResponseText joins the text chunks of a single or streamed response, one JSON object per line.
+// It handles both /api/generate ("response") and /api/chat ("message.content") objects.
+func ResponseText(response string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(response), "\n") {
+		var chunk struct {
+			Response string `json:"response"`
+			Message  struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			continue
+		}
+		sb.WriteString(chunk.Response)
+		sb.WriteString(chunk.Message.Content)
+	}
+	return sb.String()
+}
+
+// RequestText returns the prompt of the request
+func (c *Call) RequestText() string {
+	request, _ := c.Bodies()
+	return RequestText(request)
+}
+
+// RequestText extracts the prompt of a request body: the system and prompt of /api/generate, or the
+// messages of /api/chat as "role: content" paragraphs. Other bodies are returned as they are.
+func RequestText(request string) string {
+	var req struct {
+		System   string `json:"system"`
+		Prompt   string `json:"prompt"`
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(request), &req); err != nil {
+		return request
+	}
+
+	var parts []string
+	if req.System != "" {
+		parts = append(parts, "system: "+req.System)
+	}
+	if req.Prompt != "" {
+		parts = append(parts, req.Prompt)
+	}
+	for _, msg := range req.Messages {
+		if msg.Content != "" {
+			parts = append(parts, msg.Role+": "+msg.Content)
+		}
+	}
+	if parts == nil {
+		return request
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// ResponseError returns the message of the last error object in a single or streamed response,
+// such as {"error":"model not found"}, or "" if there is none
+func ResponseError(response string) string {
+	message := ""
+	for _, line := range strings.Split(strings.TrimSpace(response), "\n") {
+		if err := ParseError(line); err != "" {
+			message = err
+		}
+	}
+	return message
+}
+
+// ParseError returns the message of a single JSON error object, or "" if data is not one
+func ParseError(data string) string {
+	if !strings.Contains(data, `"error"`) {
+		return ""
+	}
+	var obj struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal([]byte(data), &obj)
+	return obj.Error
+}
+
+// SetError records the error message Ollama responded with
+func (c *Call) SetError(message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Error = message
+}
+
+// BodySize returns the number of bytes of the request and response kept on the call, compressed or not
+func (c *Call) BodySize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.compressed {
+		return len(c.compressedRequest) + len(c.compressedResponse)
+	}
+	return len(c.Request) + len(c.Response)
 }
 
 func (c *Call) UpdateResponse(data string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.Response += data
+	c.decompress()
+	if c.response.Len() != len(c.Response) {
+		// Response was replaced, e.g. by decompressing it
+		c.response.Reset()
+		c.response.WriteString(c.Response)
+	}
+	c.response.WriteString(data)
+	c.Response = c.response.String()
+}
+
+// Stats are the timings Ollama reports in the final object of a chat or generate response.
+// Durations Ollama leaves out are zero.
+type Stats struct {
+	TotalDuration      time.Duration `json:"total_duration"`
+	LoadDuration       time.Duration `json:"load_duration"`
+	PromptEvalCount    int           `json:"prompt_eval_count"`
+	PromptEvalDuration time.Duration `json:"prompt_eval_duration"`
+	EvalCount          int           `json:"eval_count"`
+	EvalDuration       time.Duration `json:"eval_duration"`
+
+	// ContextLength is the number of tokens in the returned context of /api/generate
+	ContextLength int `json:"context_length,omitempty"`
+}
+
+// ParseStats extracts the timings from the final object of a response, or returns nil for any other object
+func ParseStats(data string) *Stats {
+	if !strings.Contains(data, `"total_duration"`) {
+		return nil
+	}
+
+	var final struct {
+		Stats
+		Context []json.RawMessage `json:"context"`
+	}
+	if err := json.Unmarshal([]byte(data), &final); err != nil {
+		return nil
+	}
+	final.ContextLength = len(final.Context)
+	return &final.Stats
+}
+
+// AddRetry counts a retry of the request
+func (c *Call) AddRetry() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Retries++
+}
+
+// SetStats records the timings of the final response object
+func (c *Call) SetStats(stats *Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Stats = stats
+}
+
+// SetTokenCounts records the prompt and completion token counts of the call
+func (c *Call) SetTokenCounts(prompt, completion int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.PromptTokens = prompt
+	c.CompletionTokens = completion
+}
+
+// AddBytesOut adds to the number of response bytes of the call
+func (c *Call) AddBytesOut(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.BytesOut += n
+}
+
+// SetNote replaces the note on the call
+func (c *Call) SetNote(note string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Note = note
+}
+
+// SetDuplicateOf records the call whose response this call shares
+func (c *Call) SetDuplicateOf(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.DuplicateOf = id
+}
+
+// SetStatusCode records the HTTP status code of the response
+func (c *Call) SetStatusCode(code int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.StatusCode = code
+}
+
+// SetResponseHeaders records the headers the upstream responded with
+func (c *Call) SetResponseHeaders(header http.Header) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ResponseHeaders = header
+}
+
+// SetUpstream records the upstream URL the call was forwarded to
+func (c *Call) SetUpstream(upstream string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Upstream = upstream
+}
+
+// MarkDone marks the call as completed. It reports false and leaves a call the user finished by hand as it is.
+func (c *Call) MarkDone() bool {
+	return c.finish(StatusDone)
+}
+
+// MarkError marks the call as failed. It reports false and leaves a call the user finished by hand as it is.
+func (c *Call) MarkError() bool {
+	return c.finish(StatusError)
+}
+
+// MarkDisconnected marks the call as disconnected by the client. It reports false and leaves a call the
+// user finished by hand as it is.
+func (c *Call) MarkDisconnected() bool {
+	return c.finish(StatusDisconnected)
 }
 
-func (c *Call) MarkDone() {
+func (c *Call) finish(status CallStatus) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.FinishedByHand {
+		return false
+	}
 	now := time.Now()
 	c.EndTime = &now
-	c.Status = StatusDone
+	c.Status = status
+	c.cancel = nil
+	return true
 }
 
-func (c *Call) MarkError() {
+// FinishByHand marks an active call as done or failed on behalf of the user and aborts its upstream
+// request, for calls whose end was not detected. It reports false if the call was not active.
+func (c *Call) FinishByHand(status CallStatus) bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	if c.Status != StatusActive {
+		c.mu.Unlock()
+		return false
+	}
 	now := time.Now()
 	c.EndTime = &now
-	c.Status = StatusError
+	c.Status = status
+	c.FinishedByHand = true
+	cancel := c.cancel
+	c.cancel = nil
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	return true
 }
 
-// MarkDisconnected marks the call as disconnected by the client
-func (c *Call) MarkDisconnected() {
+// SetCancel records how to abort the upstream request of the call
+func (c *Call) SetCancel(cancel func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancel = cancel
+}
+
+// MarkRateLimited marks the call as rejected by the proxy's rate limit
+func (c *Call) MarkRateLimited() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	now := time.Now()
 	c.EndTime = &now
-	c.Status = StatusDisconnected
+	c.Status = StatusRateLimited
+	c.StatusCode = http.StatusTooManyRequests
 }
 
 type Event struct {
 	ID   string
 	Data string
 	Done bool
+
+	// Removed is set when the call was dropped from the history
+	Removed bool
 }
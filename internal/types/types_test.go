@@ -0,0 +1,76 @@
+package types
+
+import "testing"
+
+func TestResponseText(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{
+			name:     "response chunks",
+			response: `{"response":"The"}` + "\n" + `{"response":" sky"}` + "\n" + `{"response":" is blue.","done":true}` + "\n",
+			want:     "The sky is blue.",
+		},
+		{
+			name:     "message chunks",
+			response: `{"message":{"content":"The"}}` + "\n" + `{"message":{"content":" sky"}}` + "\n" + `{"message":{"content":""},"done":true}` + "\n",
+			want:     "The sky",
+		},
+		{
+			name: "message then response chunks",
+			response: `{"message":{"role":"assistant","content":"The"}}` + "\n" +
+				`{"response":" sky"}` + "\n" +
+				`{"response":" is"}` + "\n" +
+				`{"message":{"content":" blue."}}` + "\n",
+			want: "The sky is blue.",
+		},
+		{
+			name:     "single object without newline",
+			response: `{"response":"Hello","done":true}`,
+			want:     "Hello",
+		},
+		{
+			name:     "malformed line in between",
+			response: `{"response":"a"}` + "\n" + `not json` + "\n" + `{"response":"b"}` + "\n",
+			want:     "ab",
+		},
+		{
+			name: "empty",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResponseText(tt.response); got != tt.want {
+				t.Errorf("ResponseText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateResponse(t *testing.T) {
+	call := &Call{Request: `{"model":"llama3"}`}
+	call.UpdateResponse(`{"response":"a"}` + "\n")
+	before := call.Snapshot().Response
+
+	call.UpdateResponse(`{"response":"b"}` + "\n")
+	if before != `{"response":"a"}`+"\n" {
+		t.Errorf("earlier snapshot changed to %q", before)
+	}
+
+	// More of the response after it was compressed, e.g. a call finished by hand that kept streaming
+	call.Compress()
+	call.UpdateResponse(`{"response":"c"}` + "\n")
+	call.Compress()
+	call.UpdateResponse(`{"response":"d"}`)
+
+	request, response := call.Bodies()
+	if want := `{"response":"a"}` + "\n" + `{"response":"b"}` + "\n" + `{"response":"c"}` + "\n" + `{"response":"d"}`; response != want {
+		t.Errorf("response = %q, want %q", response, want)
+	}
+	if request != `{"model":"llama3"}` {
+		t.Errorf("request = %q", request)
+	}
+}
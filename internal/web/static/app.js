@@ -0,0 +1,105 @@
+// The dashboard polls the management API; everything is rendered with textContent so that
+// prompts and responses are never interpreted as HTML.
+
+const refreshInterval = 1000;
+const listFields = "id,endpoint,model,status,status_code,start_time,duration_ms,completion_tokens";
+const icons = { active: "●", done: "✓", error: "✗", disconnected: "⊘", rate_limited: "⏳" };
+
+let selectedID = null;
+
+function el(tag, text, className) {
+  const node = document.createElement(tag);
+  if (text !== undefined) node.textContent = text;
+  if (className) node.className = className;
+  return node;
+}
+
+function formatDuration(ms) {
+  return ms < 1000 ? ms + "ms" : (ms / 1000).toFixed(1) + "s";
+}
+
+async function getJSON(path) {
+  const response = await fetch(path);
+  if (!response.ok) throw new Error(path + ": " + response.status);
+  return response.json();
+}
+
+function renderList(calls) {
+  const tbody = document.querySelector("#calls tbody");
+  tbody.replaceChildren(...calls.map((call) => {
+    const row = el("tr", undefined, call.id === selectedID ? "selected" : "");
+    row.append(
+      el("td", icons[call.status] || "?", call.status),
+      el("td", new Date(call.start_time).toLocaleTimeString()),
+      el("td", call.endpoint),
+      el("td", call.model || ""),
+      el("td", formatDuration(call.duration_ms)),
+      el("td", call.completion_tokens ? String(call.completion_tokens) : ""),
+    );
+    row.addEventListener("click", () => {
+      selectedID = call.id;
+      refresh();
+    });
+    return row;
+  }));
+
+  const active = calls.filter((call) => call.status === "active").length;
+  document.getElementById("summary").textContent = `${calls.length} calls, ${active} active`;
+}
+
+function prettyJSON(text) {
+  try {
+    return JSON.stringify(JSON.parse(text), null, 2);
+  } catch {
+    return text;
+  }
+}
+
+function renderDetails(call) {
+  const details = document.getElementById("details");
+  const info = el("dl");
+  const fields = [
+    ["ID", call.id],
+    ["Status", call.status + (call.status_code ? ` (${call.status_code})` : "")],
+    ["Endpoint", `${call.method} ${call.endpoint}`],
+    ["Model", call.model],
+    ["Upstream", call.upstream],
+    ["Client", call.client_ip],
+    ["Started", new Date(call.start_time).toLocaleString()],
+    ["Duration", formatDuration(call.duration_ms)],
+    ["Tokens", call.completion_tokens ? `${call.prompt_tokens} prompt, ${call.completion_tokens} completion` : ""],
+  ];
+  for (const [name, value] of fields) {
+    if (!value) continue;
+    info.append(el("dt", name), el("dd", value));
+  }
+
+  const sections = [el("h2", "Call"), info];
+  if (call.warnings && call.warnings.length) {
+    sections.push(el("h2", "Warnings"), el("pre", call.warnings.join("\n"), "error"));
+  }
+  sections.push(el("h2", "Request"), el("pre", prettyJSON(call.request)));
+  sections.push(el("h2", "Response"), el("pre", call.response));
+  details.replaceChildren(...sections);
+}
+
+async function refresh() {
+  try {
+    renderList(await getJSON(`calls?fields=${listFields}`));
+    if (selectedID) {
+      const response = await fetch(`calls/${encodeURIComponent(selectedID)}?response_text=true`);
+      if (response.status === 404) {
+        // The call was removed from the history
+        selectedID = null;
+        document.getElementById("details").replaceChildren(el("p", "The call is no longer in the history.", "hint"));
+      } else if (response.ok) {
+        renderDetails(await response.json());
+      }
+    }
+  } catch (err) {
+    document.getElementById("summary").textContent = String(err);
+  }
+}
+
+refresh();
+setInterval(refresh, refreshInterval);
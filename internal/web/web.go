@@ -0,0 +1,24 @@
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// NewHandler serves the browser dashboard at / and passes every other path on to the management API,
+// which the dashboard polls for the calls
+func NewHandler(management http.Handler) http.Handler {
+	assets, _ := fs.Sub(static, "static")
+	files := http.FileServerFS(assets)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /{$}", files)
+	mux.Handle("GET /app.js", files)
+	mux.Handle("GET /style.css", files)
+	mux.Handle("/", management)
+	return mux
+}